@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ApiSchedule is a schedule in the responses of the HTTP API. Timezone is the timezone of the times of its slots.
+type ApiSchedule struct {
+	Namespace string `json:"namespace"`
+	GroupId   string `json:"groupId"`
+	GroupName string `json:"groupName"`
+	Timezone  string `json:"timezone"`
+	// RosterFrom and RosterTo are the range of time the API knows the slots of
+	RosterFrom time.Time `json:"rosterFrom"`
+	RosterTo   time.Time `json:"rosterTo"`
+}
+
+type ApiSlot struct {
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	Members []ApiMember `json:"members"`
+	Backup  []ApiMember `json:"backup"`
+}
+
+type ApiMember struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type ApiSchedules struct {
+	Schedules []ApiSchedule `json:"schedules"`
+}
+
+// ApiOnCall is the slot at At, Slot is nil when the roster has no slot at that time.
+type ApiOnCall struct {
+	Schedule ApiSchedule `json:"schedule"`
+	At       time.Time   `json:"at"`
+	Slot     *ApiSlot    `json:"slot"`
+}
+
+type ApiSlots struct {
+	Schedule ApiSchedule `json:"schedule"`
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Slots    []ApiSlot   `json:"slots"`
+}
+
+type ApiError struct {
+	Error string `json:"error"`
+}
+
+func newApiSchedule(roster *Roster) ApiSchedule {
+	return ApiSchedule{
+		Namespace:  roster.Namespace,
+		GroupId:    roster.Schedule.GroupId,
+		GroupName:  roster.Schedule.GroupName,
+		Timezone:   roster.Location.String(),
+		RosterFrom: roster.From,
+		RosterTo:   roster.To,
+	}
+}
+
+func newApiSlot(slot nervecentre.Slot, users []nervecentre.Member) ApiSlot {
+	return ApiSlot{
+		Start:   slot.Start,
+		End:     slot.End,
+		Members: apiMembers(slot.GetMemberList(users)),
+		Backup:  apiMembers(slot.GetBackupMemberList(users)),
+	}
+}
+
+func apiMembers(members []nervecentre.Member) []ApiMember {
+	converted := make([]ApiMember, 0, len(members))
+
+	for _, member := range members {
+		converted = append(converted, ApiMember{Id: member.UserId, Name: strings.TrimSpace(member.Name), Email: member.Email})
+	}
+
+	return converted
+}
+
+func (server *HttpServer) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	rosters, ok := server.rosters(w, r)
+
+	if !ok {
+		return
+	}
+
+	response := ApiSchedules{Schedules: make([]ApiSchedule, 0, len(rosters))}
+
+	for i := range rosters {
+		response.Schedules = append(response.Schedules, newApiSchedule(&rosters[i]))
+	}
+
+	writeJson(w, http.StatusOK, response)
+}
+
+// handleSchedule handles /v1/schedules/{groupId}/oncall and /v1/schedules/{groupId}/slots. The schedule may also be
+// given by its group name, and by the namespace query parameter when several namespaces have the same group.
+func (server *HttpServer) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/schedules/"), "/")
+
+	if len(parts) != 2 || parts[1] != "oncall" && parts[1] != "slots" {
+		httpError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	rosters, ok := server.rosters(w, r)
+
+	if !ok {
+		return
+	}
+
+	roster, status, err := findRoster(rosters, parts[0], r.URL.Query().Get("namespace"))
+
+	if err != nil {
+		httpError(w, r, status, err.Error())
+		return
+	}
+
+	if parts[1] == "oncall" {
+		server.handleOnCall(w, r, roster)
+	} else {
+		server.handleSlots(w, r, roster)
+	}
+}
+
+func (server *HttpServer) handleOnCall(w http.ResponseWriter, r *http.Request, roster *Roster) {
+	at, err := parseApiTime(r.URL.Query().Get("at"), roster.Location, server.now())
+
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "invalid at: "+err.Error())
+		return
+	}
+
+	if !roster.Covers(at) {
+		httpError(w, r, http.StatusBadRequest, fmt.Sprintf("at is outside of the roster from %s to %s", roster.From.Format(time.RFC3339), roster.To.Format(time.RFC3339)))
+		return
+	}
+
+	response := ApiOnCall{Schedule: newApiSchedule(roster), At: at}
+
+	if slot := roster.ActiveSlot(at); slot != nil {
+		apiSlot := newApiSlot(*slot, roster.Users)
+		response.Slot = &apiSlot
+	}
+
+	writeJson(w, http.StatusOK, response)
+}
+
+func (server *HttpServer) handleSlots(w http.ResponseWriter, r *http.Request, roster *Roster) {
+	from, err := parseApiTime(r.URL.Query().Get("from"), roster.Location, server.now())
+
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+
+	to, err := parseApiTime(r.URL.Query().Get("to"), roster.Location, roster.To)
+
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	if !from.Before(to) {
+		httpError(w, r, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	response := ApiSlots{Schedule: newApiSchedule(roster), From: from, To: to, Slots: make([]ApiSlot, 0)}
+
+	for _, slot := range roster.Slots() {
+		if slot.End.After(from) && slot.Start.Before(to) {
+			response.Slots = append(response.Slots, newApiSlot(slot, roster.Users))
+		}
+	}
+
+	writeJson(w, http.StatusOK, response)
+}
+
+// findRoster returns the roster of the schedule with group id or name group, in namespace when it is not empty. The
+// status to answer with is returned together with an error when not exactly one roster matches.
+func findRoster(rosters []Roster, group string, namespace string) (*Roster, int, error) {
+	var found *Roster
+
+	for i := range rosters {
+		if namespace != "" && rosters[i].Namespace != namespace {
+			continue
+		}
+
+		if len(FilterSchedules([]nervecentre.Schedule{rosters[i].Schedule}, group)) == 0 {
+			continue
+		}
+
+		if found != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("several schedules match %q, set namespace to choose one", group)
+		}
+
+		found = &rosters[i]
+	}
+
+	if found == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("no schedule found for group %q", group)
+	}
+
+	return found, http.StatusOK, nil
+}
+
+// parseApiTime parses a time in RFC 3339 or a date like 2021-01-01, which is midnight in location. Empty values are
+// fallback.
+func parseApiTime(value string, location *time.Location, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback.In(location), nil
+	}
+
+	if parsed, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a time like 2021-01-01T08:00:00+01:00 or a date like 2021-01-01", value)
+	}
+
+	return parsed.In(location), nil
+}
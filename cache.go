@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRefresh is how often the roster cache of the HTTP server refreshes when no interval is configured.
+const DefaultRefresh = 5 * time.Minute
+
+// ErrNotLoaded is returned by the roster cache until the rosters were fetched for the first time.
+var ErrNotLoaded = errors.New("the rosters are not loaded yet")
+
+// Roster is the planning of a schedule from the start of the day it was fetched on until the end of the last day that
+// was fetched.
+type Roster struct {
+	Namespace string
+	Schedule  nervecentre.Schedule
+	Location  *time.Location
+	Users     []nervecentre.Member
+	// Plannings are those of every day from From until the end of the horizon, days without members included
+	Plannings []*nervecentre.Planning
+	// Earlier are the plannings of the days before From back to the day the wachtdienst on call at From started,
+	// oldest first, so its calendar event keeps its start
+	Earlier []*nervecentre.Planning
+	From    time.Time
+	To      time.Time
+}
+
+// Covers reports whether the roster knows who is on call at t.
+func (roster *Roster) Covers(t time.Time) bool {
+	return !t.Before(roster.From) && t.Before(roster.To)
+}
+
+// Slots returns the effective slots of every day in order, see nervecentre.EffectiveSlots.
+func (roster *Roster) Slots() []nervecentre.Slot {
+	return nervecentre.EffectiveSlots(roster.Plannings)
+}
+
+// ActiveSlot returns the slot at t, nil when there is none.
+func (roster *Roster) ActiveSlot(t time.Time) *nervecentre.Slot {
+	for _, slot := range roster.Slots() {
+		if !slot.Start.After(t) && slot.End.After(t) {
+			return &slot
+		}
+	}
+
+	return nil
+}
+
+// Rosters fetches the roster of every schedule from runTime until the end of the horizon. Like Calendar it stops at
+// the first error and returns it instead of reporting it to the destinations.
+func (runner *Runner) Rosters(ctx context.Context, runTime time.Time) ([]Roster, error) {
+	rosters := make([]Roster, 0)
+
+	for _, tenant := range runner.config.Tenants {
+		tenantRosters, err := runner.TenantRosters(ctx, tenant, runTime)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rosters = append(rosters, tenantRosters...)
+	}
+
+	return rosters, nil
+}
+
+// TenantRosters fetches the roster of every schedule of tenant from runTime until the end of the horizon. The roster
+// ends with the last day that was fetched.
+func (runner *Runner) TenantRosters(ctx context.Context, tenant TenantConfig, runTime time.Time) ([]Roster, error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	client, targets, err := runner.login(ctx, tenant)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rosters := make([]Roster, 0, len(targets))
+
+	for _, target := range targets {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// A day without members does not hide the days after it
+		plannings, err := client.GetPlanningDays(ctx, target.Schedule, runTime, int(runner.config.Horizon), runner.config.Concurrency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		location := client.Location(target.Schedule)
+		localRunTime := runTime.In(location)
+		from := time.Date(localRunTime.Year(), localRunTime.Month(), localRunTime.Day(), 0, 0, 0, 0, location)
+		earlier, err := runner.earlierPlannings(ctx, client, target.Schedule, users, plannings, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rosters = append(rosters, Roster{
+			Namespace: tenant.Namespace,
+			Schedule:  target.Schedule,
+			Location:  location,
+			Users:     users,
+			Plannings: plannings,
+			Earlier:   earlier,
+			From:      from,
+			To:        from.AddDate(0, 0, len(plannings)),
+		})
+	}
+
+	return rosters, nil
+}
+
+// earlierPlannings fetches the days before from one by one, until the start of the wachtdienst on call at from is
+// found or the horizon is reached.
+func (runner *Runner) earlierPlannings(ctx context.Context, client *nervecentre.Client, schedule nervecentre.Schedule, users []nervecentre.Member, plannings []*nervecentre.Planning, from time.Time) ([]*nervecentre.Planning, error) {
+	earlier := make([]*nervecentre.Planning, 0)
+	day := from
+
+	for len(earlier) < int(runner.config.Horizon) {
+		slots := nervecentre.EffectiveSlots(append(append([]*nervecentre.Planning{}, earlier...), plannings...))
+
+		if start, ok := shiftStart(slots, users, from); !ok || start.After(day) {
+			break
+		}
+
+		day = day.AddDate(0, 0, -1)
+		planning, err := client.GetPlanningContext(ctx, schedule, day)
+
+		if err != nil {
+			return nil, err
+		}
+
+		earlier = append([]*nervecentre.Planning{planning}, earlier...)
+	}
+
+	return earlier, nil
+}
+
+// RosterCache keeps the rosters of every schedule and refreshes them from Nerve Centre on an interval, so requests to
+// the HTTP server never wait for Nerve Centre. The rosters of every tenant are refreshed separately, when the refresh
+// of a tenant fails its previous rosters are kept.
+type RosterCache struct {
+	runner   *Runner
+	interval time.Duration
+	// now returns the current time, it is replaced by the tests
+	now func() time.Time
+
+	mutex sync.RWMutex
+	// tenants holds the rosters of every tenant in the order of the configuration, nil until they were fetched
+	tenants []*tenantRosters
+}
+
+// tenantRosters are the cached rosters of a tenant and when they were fetched.
+type tenantRosters struct {
+	rosters   []Roster
+	refreshed time.Time
+}
+
+func NewRosterCache(runner *Runner, interval time.Duration) *RosterCache {
+	if interval <= 0 {
+		interval = DefaultRefresh
+	}
+
+	cache := &RosterCache{runner: runner, interval: interval, now: time.Now}
+
+	if runner != nil {
+		cache.tenants = make([]*tenantRosters, len(runner.config.Tenants))
+	}
+
+	return cache
+}
+
+// Run refreshes the rosters right away and then every interval until ctx is done. Failures are logged.
+func (cache *RosterCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(cache.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := cache.Refresh(ctx); err != nil && ctx.Err() == nil {
+			cache.runner.logf("Could not refresh the rosters: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the rosters of every tenant from Nerve Centre, replacing the cached rosters of the tenants for which
+// that succeeded. The failures of the other tenants are returned together.
+func (cache *RosterCache) Refresh(ctx context.Context) error {
+	failures := make([]string, 0)
+
+	for i, tenant := range cache.runner.config.Tenants {
+		now := cache.now()
+		rosters, err := cache.runner.TenantRosters(ctx, tenant, now)
+
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("tenant %s: %v", tenant.Namespace, err))
+			continue
+		}
+
+		cache.mutex.Lock()
+		cache.tenants[i] = &tenantRosters{rosters: rosters, refreshed: now}
+		cache.mutex.Unlock()
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// Rosters returns the cached rosters of every tenant that was fetched and when the latest of them was fetched, or
+// ErrNotLoaded before the rosters of any tenant were fetched. The rosters are shared, they must not be changed.
+func (cache *RosterCache) Rosters() ([]Roster, time.Time, error) {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	rosters := make([]Roster, 0)
+	var refreshed time.Time
+	loaded := false
+
+	for _, tenant := range cache.tenants {
+		if tenant == nil {
+			continue
+		}
+
+		rosters = append(rosters, tenant.rosters...)
+		loaded = true
+
+		if tenant.refreshed.After(refreshed) {
+			refreshed = tenant.refreshed
+		}
+	}
+
+	if !loaded {
+		return nil, time.Time{}, ErrNotLoaded
+	}
+
+	return rosters, refreshed, nil
+}
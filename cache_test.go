@@ -0,0 +1,126 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRosterCache_Refresh(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"1"},
+		"2021-01-03": {"2"},
+	})
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Horizon = 3
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, loc)
+	cache := NewRosterCache(NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false), time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if _, _, err := cache.Rosters(); err != ErrNotLoaded {
+		t.Errorf("Rosters() before the first refresh error = %v, want %v", err, ErrNotLoaded)
+	}
+
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	// A failed refresh keeps the rosters that were fetched before
+	nerveCentre.Close()
+	now = now.Add(time.Minute)
+
+	if err := cache.Refresh(context.Background()); err == nil {
+		t.Errorf("Refresh() without Nerve Centre succeeded")
+	}
+
+	rosters, refreshed, err := cache.Rosters()
+
+	if err != nil || len(rosters) != 1 || !refreshed.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("Rosters() = %d rosters of %s, %v, want the roster of %s", len(rosters), refreshed, err, now.Add(-time.Minute))
+	}
+
+	var got []string
+
+	for _, slot := range rosters[0].Slots() {
+		got = append(got, slot.Start.Format("02-01 15:04")+" "+strings.Join(slot.Members, ","))
+	}
+
+	if want := []string{"01-01 00:00 1", "02-01 00:00 1", "03-01 00:00 2"}; !Equal(got, want) {
+		t.Errorf("Slots() = %v, want %v", got, want)
+	}
+
+	if from, to := rosters[0].From, rosters[0].To; !from.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, loc)) || !to.Equal(time.Date(2021, 1, 4, 0, 0, 0, 0, loc)) {
+		t.Errorf("Roster covers %s until %s, want 2021-01-01 until 2021-01-04", from, to)
+	}
+}
+
+func TestRosterCache_RefreshTenants(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}}, map[string][]string{
+		"2021-01-01": {"1"},
+	})
+	defer nerveCentre.Close()
+
+	// The fake Nerve Centre only knows namespace acme, so the login of tenant other fails
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Horizon = 1
+	config.Tenants = append(config.Tenants, config.Tenants[0])
+	config.Tenants[1].Namespace = "other"
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, loc)
+	cache := NewRosterCache(NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false), time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if err := cache.Refresh(context.Background()); err == nil || !strings.Contains(err.Error(), "tenant other") {
+		t.Errorf("Refresh() error = %v, want the failure of tenant other", err)
+	}
+
+	rosters, refreshed, err := cache.Rosters()
+
+	if err != nil || len(rosters) != 1 || rosters[0].Namespace != "acme" || !refreshed.Equal(now) {
+		t.Errorf("Rosters() = %d rosters of %s, %v, want the roster of acme of %s", len(rosters), refreshed, err, now)
+	}
+}
+
+func TestRosterCache_Run(t *testing.T) {
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}}, map[string][]string{})
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Horizon = 1
+
+	cache := NewRosterCache(NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false), time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		cache.Run(ctx)
+		close(done)
+	}()
+
+	// Run refreshes right away, without waiting for the interval
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, _, err := cache.Rosters(); err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Run() did not refresh the rosters")
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not stop when the context was done")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+	"time"
+)
+
+// NewSnapshot merges the plannings of the days starting at the day of from, days without members included.
+func NewSnapshot(plannings []*nervecentre.Planning, from time.Time) Snapshot {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+
+	return Snapshot{
+		From:     from,
+		To:       start.AddDate(0, 0, len(plannings)),
+		Planning: nervecentre.MergePlannings(plannings),
+	}
+}
+
+// DiffSnapshots returns the changes in the time covered by both snapshots.
+func DiffSnapshots(previous Snapshot, current Snapshot) []nervecentre.SlotChange {
+	if previous.Planning == nil || current.Planning == nil {
+		return nil
+	}
+
+	from, to := previous.From, previous.To
+
+	if current.From.After(from) {
+		from = current.From
+	}
+
+	if current.To.Before(to) {
+		to = current.To
+	}
+
+	if !from.Before(to) {
+		return nil
+	}
+
+	return nervecentre.DiffPlanning(previous.Planning, current.Planning, from, to)
+}
+
+// RosterChanges are the changes made to the roster of a schedule since the previous check.
+type RosterChanges struct {
+	Schedule nervecentre.Schedule
+	Location *time.Location
+	Users    []nervecentre.Member
+	Changes  []nervecentre.SlotChange
+}
+
+// Message returns the message listing the changes, a slot that was added is good news and one that was removed is not.
+func (changes *RosterChanges) Message() *Message {
+	sections := make([]Section, 0, len(changes.Changes))
+
+	for _, change := range changes.Changes {
+		title := changes.format(change.Start) + " tot " + changes.format(change.End)
+		before := strings.Join(change.GetBeforeMembers(changes.Users), ", ")
+		after := strings.Join(change.GetAfterMembers(changes.Users), ", ")
+
+		var text string
+		var severity Severity
+
+		switch change.Kind {
+		case nervecentre.SlotAdded:
+			title = "Toegevoegd: " + title
+			text = after
+			severity = SeverityGood
+		case nervecentre.SlotRemoved:
+			title = "Vervallen: " + title
+			text = before + " niet meer ingeroosterd"
+			severity = SeverityAttention
+		default:
+			title = "Gewijzigd: " + title
+			text = before + " vervangen door " + after
+			severity = SeverityWarning
+		}
+
+		if change.Primary {
+			title += " (primair)"
+		}
+
+		sections = append(sections, Section{
+			Title:    title,
+			Text:     NewText(text),
+			Severity: severity,
+		})
+	}
+
+	return &Message{
+		Icon:     "📝",
+		Schedule: changes.Schedule,
+		Title:    "Roosterwijziging",
+		Text:     NewText("Het rooster van " + changes.Schedule.GroupName + " is aangepast in Nerve Centre"),
+		Sections: sections,
+	}
+}
+
+func (changes *RosterChanges) format(time time.Time) string {
+	return time.In(changes.Location).Format("02-01-2006 15:04")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	planning := func(day int, members ...string) *nervecentre.Planning {
+		return &nervecentre.Planning{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:   time.Date(2021, 1, day, 0, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, day+1, 0, 0, 0, 0, loc),
+					Members: members,
+				},
+			},
+		}
+	}
+	// Every snapshot has the same number of days, those after the end of the roster have no members
+	previous := NewSnapshot([]*nervecentre.Planning{planning(1, "1"), planning(2, "1"), planning(3, "2"), planning(4), planning(5)}, time.Date(2021, 1, 1, 12, 0, 0, 0, loc))
+
+	tests := []struct {
+		name      string
+		plannings []*nervecentre.Planning
+		from      time.Time
+		want      []nervecentre.SlotChange
+	}{
+		{
+			name:      "Unchanged a day later",
+			plannings: []*nervecentre.Planning{planning(2, "1"), planning(3, "2"), planning(4), planning(5), planning(6)},
+			from:      time.Date(2021, 1, 2, 12, 0, 0, 0, loc),
+			want:      []nervecentre.SlotChange{},
+		},
+		{
+			name:      "Reassigned",
+			plannings: []*nervecentre.Planning{planning(1, "1"), planning(2, "2"), planning(3, "2"), planning(4), planning(5)},
+			from:      time.Date(2021, 1, 1, 13, 0, 0, 0, loc),
+			want: []nervecentre.SlotChange{
+				{
+					Kind:   nervecentre.SlotReassigned,
+					Start:  time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+					End:    time.Date(2021, 1, 3, 0, 0, 0, 0, loc),
+					Before: []string{"1"},
+					After:  []string{"2"},
+				},
+			},
+		},
+		{
+			name:      "Roster ends earlier",
+			plannings: []*nervecentre.Planning{planning(1, "1"), planning(2, "1"), planning(3), planning(4), planning(5)},
+			from:      time.Date(2021, 1, 1, 13, 0, 0, 0, loc),
+			want: []nervecentre.SlotChange{
+				{
+					Kind:   nervecentre.SlotRemoved,
+					Start:  time.Date(2021, 1, 3, 0, 0, 0, 0, loc),
+					End:    time.Date(2021, 1, 4, 0, 0, 0, 0, loc),
+					Before: []string{"2"},
+				},
+			},
+		},
+		{
+			name:      "Roster extended",
+			plannings: []*nervecentre.Planning{planning(1, "1"), planning(2, "1"), planning(3, "2"), planning(4, "2"), planning(5, "1")},
+			from:      time.Date(2021, 1, 1, 13, 0, 0, 0, loc),
+			want: []nervecentre.SlotChange{
+				{
+					Kind:  nervecentre.SlotAdded,
+					Start: time.Date(2021, 1, 4, 0, 0, 0, 0, loc),
+					End:   time.Date(2021, 1, 5, 0, 0, 0, 0, loc),
+					After: []string{"2"},
+				},
+				{
+					Kind:  nervecentre.SlotAdded,
+					Start: time.Date(2021, 1, 5, 0, 0, 0, 0, loc),
+					End:   time.Date(2021, 1, 6, 0, 0, 0, 0, loc),
+					After: []string{"1"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := NewSnapshot(tt.plannings, tt.from)
+			if got := DiffSnapshots(previous, current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffSnapshots() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRosterChanges_Message(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	changes := &RosterChanges{
+		Schedule: nervecentre.Schedule{GroupName: "Core"},
+		Location: loc,
+		Users: []nervecentre.Member{
+			{
+				UserId: "1",
+				Name:   "Alice",
+			},
+			{
+				UserId: "2",
+				Name:   "Bob",
+			},
+		},
+		Changes: []nervecentre.SlotChange{
+			{
+				Kind:   nervecentre.SlotReassigned,
+				Start:  time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+				End:    time.Date(2021, 1, 2, 16, 0, 0, 0, time.UTC),
+				Before: []string{"1"},
+				After:  []string{"2"},
+			},
+			{
+				Kind:    nervecentre.SlotRemoved,
+				Primary: true,
+				Start:   time.Date(2021, 1, 3, 8, 0, 0, 0, time.UTC),
+				End:     time.Date(2021, 1, 3, 16, 0, 0, 0, time.UTC),
+				Before:  []string{"2"},
+			},
+		},
+	}
+	want := []Section{
+		{
+			Title:    "Gewijzigd: 02-01-2021 09:00 tot 02-01-2021 17:00",
+			Text:     NewText("Alice vervangen door Bob"),
+			Severity: SeverityWarning,
+		},
+		{
+			Title:    "Vervallen: 03-01-2021 09:00 tot 03-01-2021 17:00 (primair)",
+			Text:     NewText("Bob niet meer ingeroosterd"),
+			Severity: SeverityAttention,
+		},
+	}
+
+	if got := changes.Message().Sections; !reflect.DeepEqual(got, want) {
+		t.Errorf("Message() sections = %+v, want %+v", got, want)
+	}
+}
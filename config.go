@@ -0,0 +1,716 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Timezone     string                       `yaml:"timezone" json:"timezone"`
+	Horizon      Days                         `yaml:"horizon" json:"horizon"`
+	Concurrency  int                          `yaml:"concurrency" json:"concurrency"`
+	Combine      bool                         `yaml:"combine" json:"combine"`
+	State        string                       `yaml:"state" json:"state"`
+	Format       string                       `yaml:"format" json:"format"`
+	Reminder     ReminderConfig               `yaml:"reminder" json:"reminder"`
+	Slack        SlackConfig                  `yaml:"slack" json:"slack"`
+	Tenants      []TenantConfig               `yaml:"tenants" json:"tenants"`
+	Destinations map[string]DestinationConfig `yaml:"destinations" json:"destinations"`
+	Jobs         []JobConfig                  `yaml:"jobs" json:"jobs"`
+	Http         HttpConfig                   `yaml:"http" json:"http"`
+	// locations are the timezones by name, loaded once by Validate
+	locations map[string]*time.Location
+}
+
+type TenantConfig struct {
+	Namespace string `yaml:"namespace" json:"namespace"`
+	// BaseUrl is the url of the Nerve Centre portal, nervecentre.DefaultBaseUrl when empty
+	BaseUrl      string           `yaml:"baseUrl" json:"baseUrl"`
+	Username     string           `yaml:"username" json:"username"`
+	Password     string           `yaml:"password" json:"password"`
+	PasswordEnv  string           `yaml:"passwordEnv" json:"passwordEnv"`
+	PasswordFile string           `yaml:"passwordFile" json:"passwordFile"`
+	Timezone     string           `yaml:"timezone" json:"timezone"`
+	Destinations []string         `yaml:"destinations" json:"destinations"`
+	Schedules    []ScheduleConfig `yaml:"schedules" json:"schedules"`
+}
+
+type ScheduleConfig struct {
+	Group        string   `yaml:"group" json:"group"`
+	Timezone     string   `yaml:"timezone" json:"timezone"`
+	Destinations []string `yaml:"destinations" json:"destinations"`
+	// Usergroup is the id of a Slack user group that is kept in sync with the members on call
+	Usergroup string      `yaml:"usergroup" json:"usergroup"`
+	Topic     TopicConfig `yaml:"topic" json:"topic"`
+}
+
+// TopicConfig sets the topic of a Slack channel to the members on call, between Prefix and Suffix, which hold the
+// parts of the topic that should stay.
+type TopicConfig struct {
+	Channel string `yaml:"channel" json:"channel"`
+	Prefix  string `yaml:"prefix" json:"prefix"`
+	Suffix  string `yaml:"suffix" json:"suffix"`
+}
+
+// DestinationConfig is where messages are sent. Type is the chat service, one of Types. Slack destinations post to
+// Webhook or, when Sender is SenderApi, to Channel with the Slack token of the bot.
+type DestinationConfig struct {
+	Type    string `yaml:"type" json:"type"`
+	Sender  string `yaml:"sender" json:"sender"`
+	Webhook string `yaml:"webhook" json:"webhook"`
+	Channel string `yaml:"channel" json:"channel"`
+	// NewMessageAt is the time of day from which the overview is posted as a new message, before it the overview of
+	// the same day is updated. Only used by SenderApi, midnight when empty.
+	NewMessageAt string `yaml:"newMessageAt" json:"newMessageAt"`
+	// Email is the SMTP server and recipients of TypeEmail
+	Email EmailConfig `yaml:"email" json:"email"`
+	// Request is the request TypeGeneric sends to Webhook
+	Request RequestConfig `yaml:"request" json:"request"`
+}
+
+// RequestConfig defines the request of a generic webhook. Body and the values of Headers are Go templates executed
+// with WebhookData. When Secret is set the body is signed with HMAC-SHA256 in SignatureHeader, DefaultSignatureHeader
+// when empty.
+type RequestConfig struct {
+	Method          string            `yaml:"method" json:"method"`
+	Headers         map[string]string `yaml:"headers" json:"headers"`
+	Body            string            `yaml:"body" json:"body"`
+	Secret          string            `yaml:"secret" json:"secret"`
+	SignatureHeader string            `yaml:"signatureHeader" json:"signatureHeader"`
+}
+
+// EmailConfig sends email through an SMTP server on Port, DefaultSmtpPort when zero, with STARTTLS and, when
+// Username is set, authentication. Insecure also allows servers without STARTTLS, like a relay on localhost.
+type EmailConfig struct {
+	Host     string   `yaml:"host" json:"host"`
+	Port     int      `yaml:"port" json:"port"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	From     string   `yaml:"from" json:"from"`
+	To       []string `yaml:"to" json:"to"`
+	Insecure bool     `yaml:"insecure" json:"insecure"`
+}
+
+const (
+	SenderWebhook = "webhook"
+	SenderApi     = "api"
+)
+
+// Senders are the ways a destination can send messages, an empty sender is SenderWebhook.
+var Senders = []string{SenderWebhook, SenderApi}
+
+// UsesApi reports whether the destination posts with the Slack Web API instead of a webhook.
+func (destination DestinationConfig) UsesApi() bool {
+	return destination.Sender == SenderApi
+}
+
+// MessageDay returns when the day of the overview that runs at runTime started, that is the last NewMessageAt at or
+// before runTime in the location of runTime.
+func (destination DestinationConfig) MessageDay(runTime time.Time) time.Time {
+	at, err := time.Parse("15:04", destination.NewMessageAt)
+
+	if err != nil {
+		at = time.Time{}
+	}
+
+	day := time.Date(runTime.Year(), runTime.Month(), runTime.Day(), at.Hour(), at.Minute(), 0, 0, runTime.Location())
+
+	if day.After(runTime) {
+		day = time.Date(runTime.Year(), runTime.Month(), runTime.Day()-1, at.Hour(), at.Minute(), 0, 0, runTime.Location())
+	}
+
+	return day
+}
+
+// JobConfig runs a task on a cron schedule in serve mode, the cron expression is evaluated in the global timezone.
+type JobConfig struct {
+	Cron string `yaml:"cron" json:"cron"`
+	Task string `yaml:"task" json:"task"`
+}
+
+// HttpConfig serves the calendar and the API over HTTP in serve mode on the address Listen, for example :8080. When
+// Token is set every request has to pass it as bearer token or in the token query parameter. The rosters are fetched
+// from Nerve Centre every Refresh, DefaultRefresh when zero.
+type HttpConfig struct {
+	Listen  string   `yaml:"listen" json:"listen"`
+	Token   string   `yaml:"token" json:"token"`
+	Refresh Duration `yaml:"refresh" json:"refresh"`
+}
+
+// SlackConfig configures the Slack Web API, used next to the webhooks of the destinations.
+type SlackConfig struct {
+	// Token is a bot token, starting with xoxb-
+	Token string `yaml:"token" json:"token"`
+	// Users maps a Nerve Centre user id, name or email address to a Slack user id, so members are mentioned
+	Users map[string]string `yaml:"users" json:"users"`
+	// LookupByEmail looks up members that are not in Users by their email address in Slack
+	LookupByEmail bool `yaml:"lookupByEmail" json:"lookupByEmail"`
+}
+
+// ReminderConfig sets when members are reminded of their wachtdienst: Lead before it starts, or at the time of day At
+// on the day before when At is set.
+type ReminderConfig struct {
+	Lead Duration `yaml:"lead" json:"lead"`
+	At   string   `yaml:"at" json:"at"`
+}
+
+// RemindAt returns when the members of a slot starting at start are reminded, in the location of start.
+func (reminder ReminderConfig) RemindAt(start time.Time) time.Time {
+	if at, err := time.Parse("15:04", reminder.At); err == nil {
+		return time.Date(start.Year(), start.Month(), start.Day()-1, at.Hour(), at.Minute(), 0, 0, start.Location())
+	}
+
+	return start.Add(-time.Duration(reminder.Lead))
+}
+
+// Overrides holds the flags that were set explicitly, they take precedence over the configuration file.
+type Overrides struct {
+	Namespace   *string
+	Username    *string
+	Password    *string
+	Webhook     *string
+	Channel     *string
+	Timezone    *string
+	Horizon     *Days
+	Concurrency *int
+	Combine     *bool
+	Cron        *string
+	// Task is the task of the job of Cron, the overview when it is not set
+	Task  *string
+	State *string
+	// ReminderLead replaces a configured reminder time of day, ReminderAt takes precedence over both
+	ReminderLead *Duration
+	ReminderAt   *string
+	SlackToken   *string
+	Format       *string
+	Listen       *string
+	HttpToken    *string
+	Refresh      *Duration
+}
+
+// ConfigError points at the key of the configuration that is invalid, for example tenants[0].schedules[1].group.
+type ConfigError struct {
+	Key     string
+	Message string
+}
+
+func (err *ConfigError) Error() string {
+	return err.Key + ": " + err.Message
+}
+
+type ConfigErrors []*ConfigError
+
+func (errs ConfigErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return "invalid configuration:\n  " + strings.Join(messages, "\n  ")
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Timezone:     nervecentre.DefaultTimezone,
+		Horizon:      Days(90),
+		Concurrency:  4,
+		State:        DefaultStatePath,
+		Format:       FormatAttachments,
+		Reminder:     ReminderConfig{Lead: Duration(2 * time.Hour)},
+		Destinations: make(map[string]DestinationConfig),
+	}
+}
+
+// LoadConfig reads a JSON file when path ends in .json and a YAML file otherwise. Unknown keys are rejected, so typos
+// do not silently disable a setting.
+func LoadConfig(path string) (*Config, error) {
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	config := NewConfig()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(body))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse configuration %s: %w", path, err)
+	}
+
+	if config.Destinations == nil {
+		config.Destinations = make(map[string]DestinationConfig)
+	}
+
+	return config, nil
+}
+
+const flagDestination = "flags"
+
+func (config *Config) Override(overrides Overrides) error {
+	if overrides.Timezone != nil {
+		config.Timezone = *overrides.Timezone
+	}
+
+	if overrides.Horizon != nil {
+		config.Horizon = *overrides.Horizon
+	}
+
+	if overrides.Concurrency != nil {
+		config.Concurrency = *overrides.Concurrency
+	}
+
+	if overrides.Combine != nil {
+		config.Combine = *overrides.Combine
+	}
+
+	if overrides.State != nil {
+		config.State = *overrides.State
+	}
+
+	if overrides.ReminderLead != nil {
+		config.Reminder = ReminderConfig{Lead: *overrides.ReminderLead}
+	}
+
+	if overrides.ReminderAt != nil {
+		config.Reminder.At = *overrides.ReminderAt
+	}
+
+	if overrides.Format != nil {
+		config.Format = *overrides.Format
+	}
+
+	if overrides.SlackToken != nil {
+		config.Slack.Token = *overrides.SlackToken
+	}
+
+	if overrides.Listen != nil {
+		config.Http.Listen = *overrides.Listen
+	}
+
+	if overrides.HttpToken != nil {
+		config.Http.Token = *overrides.HttpToken
+	}
+
+	if overrides.Refresh != nil {
+		config.Http.Refresh = *overrides.Refresh
+	}
+
+	if overrides.Cron != nil {
+		task := TaskOverview
+
+		if overrides.Task != nil {
+			task = *overrides.Task
+		}
+
+		config.Jobs = []JobConfig{{Cron: *overrides.Cron, Task: task}}
+	}
+
+	if overrides.Namespace != nil || overrides.Username != nil || overrides.Password != nil {
+		tenant := TenantConfig{}
+
+		switch {
+		case overrides.Namespace != nil:
+			// A one-off run for a single namespace, starting from its configuration when there is one
+			for _, configured := range config.Tenants {
+				if configured.Namespace == *overrides.Namespace {
+					tenant = configured
+				}
+			}
+			tenant.Namespace = *overrides.Namespace
+		case len(config.Tenants) == 1:
+			tenant = config.Tenants[0]
+		case len(config.Tenants) > 1:
+			return fmt.Errorf("-namespace is required to override the credentials when several tenants are configured")
+		}
+
+		if overrides.Username != nil {
+			tenant.Username = *overrides.Username
+		}
+
+		if overrides.Password != nil {
+			tenant.Password = *overrides.Password
+			tenant.PasswordEnv = ""
+			tenant.PasswordFile = ""
+		}
+
+		config.Tenants = []TenantConfig{tenant}
+	}
+
+	if overrides.Webhook != nil {
+		destination := DestinationConfig{Webhook: *overrides.Webhook}
+
+		if overrides.Channel != nil {
+			destination.Channel = *overrides.Channel
+		}
+
+		// Everything is posted to the webhook of the flags instead of the configured destinations
+		config.Destinations = map[string]DestinationConfig{flagDestination: destination}
+
+		for i := range config.Tenants {
+			config.Tenants[i].Destinations = []string{flagDestination}
+
+			for j := range config.Tenants[i].Schedules {
+				config.Tenants[i].Schedules[j].Destinations = nil
+			}
+		}
+	} else if overrides.Channel != nil {
+		for name, destination := range config.Destinations {
+			destination.Channel = *overrides.Channel
+			config.Destinations[name] = destination
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the whole configuration, returning ConfigErrors with every problem found.
+func (config *Config) Validate() error {
+	return config.validate(true)
+}
+
+// ValidateWithoutDestinations checks the configuration like Validate, but allows tenants and schedules without
+// destinations. Exports and the HTTP server do not send anything, so they can do without.
+func (config *Config) ValidateWithoutDestinations() error {
+	return config.validate(false)
+}
+
+func (config *Config) validate(needsDestinations bool) error {
+	errs := ConfigErrors{}
+
+	addError := func(key string, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	config.locations = make(map[string]*time.Location)
+
+	validateTimezone := func(key string, timezone string) {
+		if timezone == "" {
+			return
+		}
+
+		location, err := tz.LoadLocation(timezone)
+
+		if err != nil {
+			addError(key, "unknown timezone %q", timezone)
+			return
+		}
+
+		config.locations[timezone] = location
+	}
+
+	validateTimezone("timezone", nervecentre.DefaultTimezone)
+
+	validateDestinations := func(key string, destinations []string) {
+		for i, destination := range destinations {
+			if _, ok := config.Destinations[destination]; !ok {
+				addError(fmt.Sprintf("%s[%d]", key, i), "unknown destination %q", destination)
+			}
+		}
+	}
+
+	validateEmail := func(key string, email EmailConfig) {
+		if email.Host == "" {
+			addError(key+".host", "is required")
+		}
+
+		if email.From == "" {
+			addError(key+".from", "is required")
+		} else if _, err := mail.ParseAddress(email.From); err != nil {
+			addError(key+".from", "invalid address %q", email.From)
+		}
+
+		if len(email.To) == 0 {
+			addError(key+".to", "at least one recipient is required")
+		}
+
+		for i, recipient := range email.To {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				addError(fmt.Sprintf("%s.to[%d]", key, i), "invalid address %q", recipient)
+			}
+		}
+	}
+
+	validateTimezone("timezone", config.Timezone)
+
+	if config.Horizon < 1 {
+		addError("horizon", "must be at least one day")
+	}
+
+	if config.Concurrency < 1 {
+		addError("concurrency", "must be at least 1")
+	}
+
+	if config.State == "" {
+		addError("state", "is required")
+	}
+
+	if !isFormat(config.Format) {
+		addError("format", "unknown format %q, should be one of %s", config.Format, strings.Join(Formats, ", "))
+	}
+
+	if config.Http.Refresh < 0 {
+		addError("http.refresh", "must not be negative")
+	}
+
+	if config.Reminder.Lead < 0 {
+		addError("reminder.lead", "must not be negative")
+	}
+
+	if config.Slack.LookupByEmail && config.Slack.Token == "" {
+		addError("slack.token", "is required to look up users by email")
+	}
+
+	if config.Reminder.At != "" {
+		if _, err := time.Parse("15:04", config.Reminder.At); err != nil {
+			addError("reminder.at", "invalid time of day %q, use for example 19:00", config.Reminder.At)
+		}
+	}
+
+	if len(config.Tenants) == 0 {
+		addError("tenants", "at least one tenant is required")
+	}
+
+	names := make([]string, 0, len(config.Destinations))
+
+	for name := range config.Destinations {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		destination := config.Destinations[name]
+		key := "destinations." + name
+
+		if destination.Type != "" && !isType(destination.Type) {
+			addError(key+".type", "unknown type %q, should be one of %s", destination.Type, strings.Join(Types, ", "))
+		}
+
+		if destination.Type != "" && destination.Type != TypeSlack && destination.Sender == SenderApi {
+			addError(key+".sender", "is only supported by Slack")
+		}
+
+		if destination.Type == TypeGeneric {
+			if destination.Request.Body == "" {
+				addError(key+".request.body", "is required")
+			} else if _, err := ParseRequest(destination.Request); err != nil {
+				addError(key+".request", "%v", err)
+			}
+		}
+
+		if destination.Type == TypeEmail {
+			validateEmail(key+".email", destination.Email)
+		} else {
+			switch destination.Sender {
+			case "", SenderWebhook:
+				if destination.Webhook == "" {
+					addError(key+".webhook", "is required")
+				}
+			case SenderApi:
+				if destination.Channel == "" {
+					addError(key+".channel", "is required to post with the Slack Web API")
+				}
+
+				if config.Slack.Token == "" {
+					addError(key+".sender", "needs a Slack token")
+				}
+			default:
+				addError(key+".sender", "unknown sender %q, should be one of %s", destination.Sender, strings.Join(Senders, ", "))
+			}
+		}
+
+		if destination.NewMessageAt != "" {
+			if _, err := time.Parse("15:04", destination.NewMessageAt); err != nil {
+				addError(key+".newMessageAt", "invalid time of day %q, use for example 08:00", destination.NewMessageAt)
+			}
+		}
+	}
+
+	for i, job := range config.Jobs {
+		key := fmt.Sprintf("jobs[%d]", i)
+
+		if _, err := ParseCron(job.Cron); err != nil {
+			addError(key+".cron", "%v", err)
+		}
+
+		if !IsTask(job.Task) {
+			addError(key+".task", "unknown task %q, should be one of %s", job.Task, strings.Join(Tasks, ", "))
+		}
+	}
+
+	for i, tenant := range config.Tenants {
+		key := fmt.Sprintf("tenants[%d]", i)
+
+		if tenant.Namespace == "" {
+			addError(key+".namespace", "is required")
+		}
+
+		if tenant.Username == "" {
+			addError(key+".username", "is required")
+		}
+
+		passwords := 0
+
+		for _, password := range []string{tenant.Password, tenant.PasswordEnv, tenant.PasswordFile} {
+			if password != "" {
+				passwords++
+			}
+		}
+
+		if passwords != 1 {
+			addError(key+".password", "exactly one of password, passwordEnv and passwordFile is required")
+		}
+
+		validateTimezone(key+".timezone", tenant.Timezone)
+		validateDestinations(key+".destinations", tenant.Destinations)
+
+		if needsDestinations && len(tenant.Schedules) == 0 && len(tenant.Destinations) == 0 {
+			addError(key+".destinations", "is required when no schedules are configured")
+		}
+
+		for j, schedule := range tenant.Schedules {
+			scheduleKey := fmt.Sprintf("%s.schedules[%d]", key, j)
+
+			if schedule.Group == "" {
+				addError(scheduleKey+".group", "is required")
+			}
+
+			validateTimezone(scheduleKey+".timezone", schedule.Timezone)
+			validateDestinations(scheduleKey+".destinations", schedule.Destinations)
+
+			if needsDestinations && len(schedule.Destinations) == 0 && len(tenant.Destinations) == 0 {
+				addError(scheduleKey+".destinations", "is required when the tenant has no destinations")
+			}
+
+			if schedule.Usergroup != "" && config.Slack.Token == "" {
+				addError(scheduleKey+".usergroup", "needs a Slack token")
+			}
+
+			if schedule.Topic.Channel != "" && config.Slack.Token == "" {
+				addError(scheduleKey+".topic.channel", "needs a Slack token")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func isFormat(format string) bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isType(destinationType string) bool {
+	for _, known := range Types {
+		if destinationType == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolvePassword returns the password of the tenant, reading it from the environment or a file when configured so.
+func (tenant *TenantConfig) ResolvePassword() (string, error) {
+	switch {
+	case tenant.PasswordEnv != "":
+		password, ok := os.LookupEnv(tenant.PasswordEnv)
+
+		if !ok {
+			return "", fmt.Errorf("environment variable %s of tenant %s is not set", tenant.PasswordEnv, tenant.Namespace)
+		}
+
+		return password, nil
+	case tenant.PasswordFile != "":
+		password, err := ioutil.ReadFile(tenant.PasswordFile)
+
+		if err != nil {
+			return "", fmt.Errorf("could not read password of tenant %s: %w", tenant.Namespace, err)
+		}
+
+		return strings.TrimSpace(string(password)), nil
+	default:
+		return tenant.Password, nil
+	}
+}
+
+// Location returns the timezone of schedule, falling back to the timezone of the tenant and then the global one. The
+// timezones loaded by Validate are reused, others are loaded.
+func (config *Config) Location(tenant TenantConfig, schedule ScheduleConfig) (*time.Location, error) {
+	timezone := nervecentre.DefaultTimezone
+
+	for _, configured := range []string{config.Timezone, tenant.Timezone, schedule.Timezone} {
+		if configured != "" {
+			timezone = configured
+		}
+	}
+
+	if location, ok := config.locations[timezone]; ok {
+		return location, nil
+	}
+
+	return tz.LoadLocation(timezone)
+}
+
+// DestinationsFor returns the names of the destinations schedule posts to.
+func (tenant *TenantConfig) DestinationsFor(schedule ScheduleConfig) []string {
+	if len(schedule.Destinations) > 0 {
+		return schedule.Destinations
+	}
+
+	return tenant.Destinations
+}
+
+// AllDestinations returns the names of every destination of the tenant, used to report failures of the tenant itself.
+func (tenant *TenantConfig) AllDestinations() []string {
+	seen := make(map[string]bool)
+	destinations := make([]string, 0, len(tenant.Destinations))
+
+	for _, destination := range tenant.Destinations {
+		if !seen[destination] {
+			seen[destination] = true
+			destinations = append(destinations, destination)
+		}
+	}
+
+	for _, schedule := range tenant.Schedules {
+		for _, destination := range schedule.Destinations {
+			if !seen[destination] {
+				seen[destination] = true
+				destinations = append(destinations, destination)
+			}
+		}
+	}
+
+	return destinations
+}
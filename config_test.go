@@ -0,0 +1,389 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	want := &Config{
+		Timezone:    "Europe/Lisbon",
+		Horizon:     Days(14),
+		Concurrency: 4,
+		State:       DefaultStatePath,
+		Format:      FormatAttachments,
+		Reminder:    ReminderConfig{Lead: Duration(2 * time.Hour)},
+		Tenants: []TenantConfig{
+			{
+				Namespace:   "acme",
+				Username:    "bot",
+				PasswordEnv: "ACME_PASSWORD",
+				Schedules: []ScheduleConfig{
+					{
+						Group:        "Core",
+						Destinations: []string{"ops"},
+					},
+				},
+			},
+		},
+		Destinations: map[string]DestinationConfig{
+			"ops": {
+				Webhook: "https://hooks.slack.com/services/T/B/X",
+				Channel: "#ops",
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "YAML",
+			file: "config.yaml",
+			content: `
+timezone: Europe/Lisbon
+horizon: 2w
+tenants:
+  - namespace: acme
+    username: bot
+    passwordEnv: ACME_PASSWORD
+    schedules:
+      - group: Core
+        destinations: [ops]
+destinations:
+  ops:
+    webhook: https://hooks.slack.com/services/T/B/X
+    channel: "#ops"
+`,
+		},
+		{
+			name: "JSON",
+			file: "config.json",
+			content: `{
+  "timezone": "Europe/Lisbon",
+  "horizon": "14d",
+  "tenants": [{
+    "namespace": "acme",
+    "username": "bot",
+    "passwordEnv": "ACME_PASSWORD",
+    "schedules": [{"group": "Core", "destinations": ["ops"]}]
+  }],
+  "destinations": {"ops": {"webhook": "https://hooks.slack.com/services/T/B/X", "channel": "#ops"}}
+}`,
+		},
+		{
+			name: "Unknown YAML key",
+			file: "config.yml",
+			content: `
+tenants:
+  - namespace: acme
+    pasword: secret
+`,
+			wantErr: "line 4: field pasword not found",
+		},
+		{
+			name:    "Unknown JSON key",
+			file:    "config.json",
+			content: `{"tenants": [{"namespace": "acme", "pasword": "secret"}]}`,
+			wantErr: `unknown field "pasword"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfig() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   func(config *Config)
+		wantKeys []string
+	}{
+		{
+			name:     "Valid",
+			config:   func(config *Config) {},
+			wantKeys: nil,
+		},
+		{
+			name: "Unknown destination",
+			config: func(config *Config) {
+				config.Tenants[0].Schedules[0].Destinations = []string{"ops", "dev"}
+			},
+			wantKeys: []string{"tenants[0].schedules[0].destinations[1]"},
+		},
+		{
+			name: "Missing credentials",
+			config: func(config *Config) {
+				config.Tenants[0].Username = ""
+				config.Tenants[0].Password = ""
+			},
+			wantKeys: []string{"tenants[0].username", "tenants[0].password"},
+		},
+		{
+			name: "Two passwords",
+			config: func(config *Config) {
+				config.Tenants[0].PasswordFile = "/run/secrets/password"
+			},
+			wantKeys: []string{"tenants[0].password"},
+		},
+		{
+			name: "Unknown timezone",
+			config: func(config *Config) {
+				config.Tenants[0].Schedules[0].Timezone = "Europe/Atlantis"
+			},
+			wantKeys: []string{"tenants[0].schedules[0].timezone"},
+		},
+		{
+			name: "Schedule without destinations",
+			config: func(config *Config) {
+				config.Tenants[0].Schedules[0].Destinations = nil
+			},
+			wantKeys: []string{"tenants[0].schedules[0].destinations"},
+		},
+		{
+			name: "Destination without webhook",
+			config: func(config *Config) {
+				config.Destinations["ops"] = DestinationConfig{Channel: "#ops"}
+			},
+			wantKeys: []string{"destinations.ops.webhook"},
+		},
+		{
+			name: "Api destination without token",
+			config: func(config *Config) {
+				config.Destinations["ops"] = DestinationConfig{Sender: SenderApi, NewMessageAt: "8:00am"}
+			},
+			wantKeys: []string{"destinations.ops.channel", "destinations.ops.sender", "destinations.ops.newMessageAt"},
+		},
+		{
+			name: "Unknown destination type",
+			config: func(config *Config) {
+				config.Destinations["ops"] = DestinationConfig{Type: "irc", Webhook: "https://hooks.slack.com/services/T/B/X"}
+			},
+			wantKeys: []string{"destinations.ops.type"},
+		},
+		{
+			name: "Email destination without recipients",
+			config: func(config *Config) {
+				config.Destinations["ops"] = DestinationConfig{Type: TypeEmail, Email: EmailConfig{Host: "smtp.example.com", From: "wachtdienst"}}
+			},
+			wantKeys: []string{"destinations.ops.email.from", "destinations.ops.email.to"},
+		},
+		{
+			name: "Generic destination with invalid template",
+			config: func(config *Config) {
+				config.Destinations["ops"] = DestinationConfig{Type: TypeGeneric, Webhook: "https://status.example.com", Request: RequestConfig{Body: "{{.Current"}}
+			},
+			wantKeys: []string{"destinations.ops.request"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewConfig()
+			config.Tenants = []TenantConfig{
+				{
+					Namespace: "acme",
+					Username:  "bot",
+					Password:  "secret",
+					Schedules: []ScheduleConfig{
+						{
+							Group:        "Core",
+							Destinations: []string{"ops"},
+						},
+					},
+				},
+			}
+			config.Destinations["ops"] = DestinationConfig{Webhook: "https://hooks.slack.com/services/T/B/X"}
+			tt.config(config)
+
+			err := config.Validate()
+
+			var gotKeys []string
+			if errs, ok := err.(ConfigErrors); ok {
+				for _, err := range errs {
+					gotKeys = append(gotKeys, err.Key)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate() error = %v, want ConfigErrors", err)
+			}
+
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("Validate() keys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestConfig_Override(t *testing.T) {
+	namespace := "other"
+	username := "alice"
+	password := "secret"
+	webhook := "https://hooks.slack.com/services/T/B/Y"
+	channel := "#test"
+
+	config := NewConfig()
+	config.Tenants = []TenantConfig{
+		{
+			Namespace:   "acme",
+			Username:    "bot",
+			PasswordEnv: "ACME_PASSWORD",
+			Schedules: []ScheduleConfig{
+				{
+					Group:        "Core",
+					Destinations: []string{"ops"},
+				},
+			},
+		},
+		{
+			Namespace:    "other",
+			Username:     "bot",
+			PasswordFile: "/run/secrets/other",
+			Destinations: []string{"ops"},
+		},
+	}
+	config.Destinations["ops"] = DestinationConfig{Webhook: "https://hooks.slack.com/services/T/B/X", Channel: "#ops"}
+
+	if err := config.Override(Overrides{Username: &username}); err == nil {
+		t.Errorf("Override() without namespace for several tenants should fail")
+	}
+
+	err := config.Override(Overrides{
+		Namespace: &namespace,
+		Username:  &username,
+		Password:  &password,
+		Webhook:   &webhook,
+		Channel:   &channel,
+	})
+
+	if err != nil {
+		t.Fatalf("Override() error = %v", err)
+	}
+
+	wantTenants := []TenantConfig{
+		{
+			Namespace:    "other",
+			Username:     "alice",
+			Password:     "secret",
+			Destinations: []string{flagDestination},
+		},
+	}
+
+	if !reflect.DeepEqual(config.Tenants, wantTenants) {
+		t.Errorf("Override() tenants = %+v, want %+v", config.Tenants, wantTenants)
+	}
+
+	wantDestinations := map[string]DestinationConfig{
+		flagDestination: {Webhook: webhook, Channel: channel},
+	}
+
+	if !reflect.DeepEqual(config.Destinations, wantDestinations) {
+		t.Errorf("Override() destinations = %+v, want %+v", config.Destinations, wantDestinations)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() after Override() error = %v", err)
+	}
+}
+
+func TestConfig_Override_Cron(t *testing.T) {
+	cron := "*/5 * * * *"
+	task := TaskHandover
+
+	config := NewConfig()
+	config.Jobs = []JobConfig{{Cron: "30 8 * * *", Task: TaskOverview}}
+
+	if err := config.Override(Overrides{Cron: &cron}); err != nil {
+		t.Fatalf("Override() error = %v", err)
+	}
+
+	if want := []JobConfig{{Cron: cron, Task: TaskOverview}}; !reflect.DeepEqual(config.Jobs, want) {
+		t.Errorf("Override() without task jobs = %+v, want %+v", config.Jobs, want)
+	}
+
+	if err := config.Override(Overrides{Cron: &cron, Task: &task}); err != nil {
+		t.Fatalf("Override() error = %v", err)
+	}
+
+	if want := []JobConfig{{Cron: cron, Task: TaskHandover}}; !reflect.DeepEqual(config.Jobs, want) {
+		t.Errorf("Override() with task jobs = %+v, want %+v", config.Jobs, want)
+	}
+}
+
+func TestConfig_Location(t *testing.T) {
+	config := NewConfig()
+	config.Timezone = "Europe/Amsterdam"
+	config.Tenants = []TenantConfig{
+		{
+			Namespace:    "acme",
+			Username:     "bot",
+			Password:     "secret",
+			Destinations: []string{"ops"},
+			Schedules:    []ScheduleConfig{{Group: "Lisbon", Timezone: "Europe/Lisbon"}},
+		},
+	}
+	config.Destinations["ops"] = DestinationConfig{Webhook: "https://hooks.slack.com/services/T/B/X"}
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		schedule ScheduleConfig
+		want     string
+	}{
+		{
+			name: "Global timezone",
+			want: "Europe/Amsterdam",
+		},
+		{
+			name:     "Timezone of the schedule",
+			schedule: config.Tenants[0].Schedules[0],
+			want:     "Europe/Lisbon",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.Location(config.Tenants[0], tt.schedule)
+			if err != nil {
+				t.Fatalf("Location() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Location() = %s, want %s", got, tt.want)
+			}
+			// The location loaded by Validate is reused
+			if again, _ := config.Location(config.Tenants[0], tt.schedule); again != got {
+				t.Errorf("Location() loaded %s again", tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+	"time"
+)
+
+// Coverage holds the coverage gaps of a schedule from the run time to the end of the roster.
+type Coverage struct {
+	Schedule nervecentre.Schedule
+	Location *time.Location
+	Users    []nervecentre.Member
+	Gaps     []nervecentre.CoverageGap
+}
+
+// NewCoverage returns the coverage gaps in the plannings of consecutive days from the day of runTime. Days without
+// members in between are gaps, those at the end are after the end of the roster and are left out.
+func NewCoverage(schedule nervecentre.Schedule, users []nervecentre.Member, plannings []*nervecentre.Planning, runTime time.Time) *Coverage {
+	for len(plannings) > 0 && !plannings[len(plannings)-1].HasMembers() {
+		plannings = plannings[:len(plannings)-1]
+	}
+
+	start := time.Date(runTime.Year(), runTime.Month(), runTime.Day(), 0, 0, 0, 0, runTime.Location())
+	end := start.AddDate(0, 0, len(plannings))
+
+	return &Coverage{
+		Schedule: schedule,
+		Location: runTime.Location(),
+		Users:    users,
+		Gaps:     nervecentre.MergePlannings(plannings).CoverageGaps(runTime, end),
+	}
+}
+
+// Message returns the message listing the gaps.
+func (coverage *Coverage) Message() *Message {
+	lines := make([]string, 0, len(coverage.Gaps))
+
+	for _, gap := range coverage.Gaps {
+		members := strings.Join(gap.GetMembers(coverage.Users), ", ")
+		period := coverage.format(gap.Start) + " tot " + coverage.format(gap.End)
+
+		switch gap.Kind {
+		case nervecentre.GapUncovered:
+			lines = append(lines, fmt.Sprintf("• %s: niemand ingeroosterd", period))
+		case nervecentre.GapUnderstaffed:
+			lines = append(lines, fmt.Sprintf("• %s: %d van minimaal %d ingeroosterd (%s)", period, len(gap.Members), gap.MinMembers, members))
+		case nervecentre.GapOverstaffed:
+			lines = append(lines, fmt.Sprintf("• %s: %d van maximaal %d ingeroosterd (%s)", period, len(gap.Members), gap.MaxMembers, members))
+		}
+	}
+
+	return &Message{
+		Icon:     "⚠️",
+		Schedule: coverage.Schedule,
+		Title:    "Gaten in het rooster",
+		Text:     NewText("Het rooster van " + coverage.Schedule.GroupName + " is niet volledig bezet"),
+		Sections: []Section{
+			{
+				Title:    "Gaten in het rooster",
+				Text:     NewText(strings.Join(lines, "\n")),
+				Severity: SeverityAttention,
+			},
+		},
+	}
+}
+
+func (coverage *Coverage) format(time time.Time) string {
+	return time.In(coverage.Location).Format("02-01-2006 15:04")
+}
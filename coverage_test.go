@@ -0,0 +1,94 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewCoverage(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{
+			UserId: "1",
+			Name:   "Alice",
+		},
+		{
+			UserId: "2",
+			Name:   "Bob",
+		},
+	}
+	plannings := []*nervecentre.Planning{
+		{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:      time.Date(2021, 1, 1, 0, 0, 0, 0, loc),
+					End:        time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+					Members:    []string{"1"},
+					MinMembers: 2,
+				},
+				{
+					Start: time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+					End:   time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+				},
+			},
+		},
+		{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:      time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+					End:        time.Date(2021, 1, 3, 0, 0, 0, 0, loc),
+					Members:    []string{"1", "2"},
+					MaxMembers: 1,
+				},
+			},
+		},
+	}
+
+	coverage := NewCoverage(nervecentre.Schedule{GroupName: "Core"}, users, plannings, time.Date(2021, 1, 1, 8, 0, 0, 0, loc))
+
+	want := []Section{
+		{
+			Title: "Gaten in het rooster",
+			Text: NewText("• 01-01-2021 08:00 tot 01-01-2021 12:00: 1 van minimaal 2 ingeroosterd (Alice)\n" +
+				"• 01-01-2021 12:00 tot 02-01-2021 00:00: niemand ingeroosterd\n" +
+				"• 02-01-2021 00:00 tot 03-01-2021 00:00: 2 van maximaal 1 ingeroosterd (Alice, Bob)"),
+			Severity: SeverityAttention,
+		},
+	}
+
+	if got := coverage.Message().Sections; !reflect.DeepEqual(got, want) {
+		t.Errorf("Message() sections = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewCoverage_EmptyDays(t *testing.T) {
+	day := func(day int) time.Time {
+		return time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC)
+	}
+	planning := func(day time.Time, members ...string) *nervecentre.Planning {
+		return &nervecentre.Planning{
+			BaseTimeSlots: []nervecentre.Slot{{Start: day, End: day.AddDate(0, 0, 1), Members: members}},
+		}
+	}
+	plannings := []*nervecentre.Planning{
+		planning(day(1), "1"),
+		planning(day(2)),
+		planning(day(3), "1"),
+		planning(day(4)),
+		planning(day(5)),
+	}
+
+	coverage := NewCoverage(nervecentre.Schedule{GroupName: "Core"}, []nervecentre.Member{{UserId: "1", Name: "Alice"}}, plannings, day(1))
+
+	// The empty day in between is a gap, the days after the end of the roster are not
+	want := []nervecentre.CoverageGap{
+		{Start: day(2), End: day(3), Kind: nervecentre.GapUncovered},
+	}
+
+	if !reflect.DeepEqual(coverage.Gaps, want) {
+		t.Errorf("NewCoverage() gaps = %+v, want %+v", coverage.Gaps, want)
+	}
+}
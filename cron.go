@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression with the five standard fields: minute, hour, day of month, month and day
+// of week. Fields accept *, lists, ranges, steps and three letter month and day names, and the expression can also be
+// one of @hourly, @daily, @weekly, @monthly and @yearly.
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// When both the day of month and the day of week are restricted, either of them has to match, as in cron
+	anyDay bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdays = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+func ParseCron(expression string) (*CronSchedule, error) {
+	if descriptor, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(expression))]; ok {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields, has %d", expression, len(fields))
+	}
+
+	schedule := &CronSchedule{}
+
+	var err error
+
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute of %q: %w", expression, err)
+	}
+
+	if schedule.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour of %q: %w", expression, err)
+	}
+
+	if schedule.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month of %q: %w", expression, err)
+	}
+
+	if schedule.months, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("month of %q: %w", expression, err)
+	}
+
+	// Both 0 and 7 are Sunday
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdays); err != nil {
+		return nil, fmt.Errorf("day of week of %q: %w", expression, err)
+	}
+
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	schedule.anyDay = !strings.HasPrefix(fields[2], "*") && !strings.HasPrefix(fields[4], "*")
+
+	return schedule, nil
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		rangePart := part
+
+		if index := strings.Index(part, "/"); index >= 0 {
+			parsed, err := strconv.Atoi(part[index+1:])
+
+			if err != nil || parsed < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+
+			step = parsed
+			rangePart = part[:index]
+		}
+
+		start, end := min, max
+
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+
+			if start, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+
+			end = start
+
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 5/15 means every 15 starting at 5
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is outside of %d-%d", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+
+	return number, nil
+}
+
+// Next returns the first time after t that matches the schedule, in the location of t. Times that do not exist
+// because of a DST transition are skipped, a zero time is returned when nothing matches within five years.
+func (schedule *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if schedule.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !schedule.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if schedule.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if schedule.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (schedule *CronSchedule) matchesDay(t time.Time) bool {
+	day := schedule.days&(1<<uint(t.Day())) != 0
+	weekday := schedule.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if schedule.anyDay {
+		return day || weekday
+	}
+
+	return day && weekday
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{
+			name:       "Daily",
+			expression: "30 8 * * *",
+		},
+		{
+			name:       "Names, ranges and steps",
+			expression: "*/15 8-18 * jan-jun mon-fri",
+		},
+		{
+			name:       "Descriptor",
+			expression: "@weekly",
+		},
+		{
+			name:       "Too few fields",
+			expression: "30 8 * *",
+			wantErr:    true,
+		},
+		{
+			name:       "Out of range",
+			expression: "60 8 * * *",
+			wantErr:    true,
+		},
+		{
+			name:       "Invalid step",
+			expression: "*/0 8 * * *",
+			wantErr:    true,
+		},
+		{
+			name:       "Unknown name",
+			expression: "0 8 * * someday",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCron(tt.expression); (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		want       time.Time
+	}{
+		{
+			name:       "Later today",
+			expression: "30 8 * * *",
+			from:       time.Date(2021, 5, 31, 7, 0, 0, 0, loc),
+			want:       time.Date(2021, 5, 31, 8, 30, 0, 0, loc),
+		},
+		{
+			name:       "Tomorrow when just run",
+			expression: "30 8 * * *",
+			from:       time.Date(2021, 5, 31, 8, 30, 0, 0, loc),
+			want:       time.Date(2021, 6, 1, 8, 30, 0, 0, loc),
+		},
+		{
+			name:       "Monday weekly overview",
+			expression: "0 9 * * mon",
+			from:       time.Date(2021, 6, 2, 12, 0, 0, 0, loc),
+			want:       time.Date(2021, 6, 7, 9, 0, 0, 0, loc),
+		},
+		{
+			name:       "Sunday as 7",
+			expression: "0 9 * * 7",
+			from:       time.Date(2021, 6, 2, 12, 0, 0, 0, loc),
+			want:       time.Date(2021, 6, 6, 9, 0, 0, 0, loc),
+		},
+		{
+			name:       "Every 15 minutes",
+			expression: "*/15 * * * *",
+			from:       time.Date(2021, 6, 2, 12, 7, 30, 0, loc),
+			want:       time.Date(2021, 6, 2, 12, 15, 0, 0, loc),
+		},
+		{
+			name:       "Day of month or day of week",
+			expression: "0 0 13 * fri",
+			from:       time.Date(2021, 6, 1, 0, 0, 0, 0, loc),
+			want:       time.Date(2021, 6, 4, 0, 0, 0, 0, loc),
+		},
+		{
+			name:       "End of year",
+			expression: "@monthly",
+			from:       time.Date(2021, 12, 15, 0, 0, 0, 0, loc),
+			want:       time.Date(2022, 1, 1, 0, 0, 0, 0, loc),
+		},
+		{
+			name:       "Skipped hour at DST start",
+			expression: "30 2 * * *",
+			from:       time.Date(2021, 3, 27, 12, 0, 0, 0, loc),
+			want:       time.Date(2021, 3, 29, 2, 30, 0, 0, loc),
+		},
+		{
+			name:       "Daily run on DST end",
+			expression: "30 8 * * *",
+			from:       time.Date(2021, 10, 30, 12, 0, 0, 0, loc),
+			want:       time.Date(2021, 10, 31, 8, 30, 0, 0, loc),
+		},
+		{
+			name:       "Never",
+			expression: "0 0 30 feb *",
+			from:       time.Date(2021, 1, 1, 0, 0, 0, 0, loc),
+			want:       time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
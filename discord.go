@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discordMaxEmbeds is the number of embeds Discord accepts in a single message.
+const discordMaxEmbeds = 10
+
+// DiscordPayload is the payload of a Discord webhook. AllowedMentions is always empty, so names that look like a
+// mention never notify anyone.
+type DiscordPayload struct {
+	Username        string                 `json:"username,omitempty"`
+	Content         string                 `json:"content,omitempty"`
+	Embeds          []DiscordEmbed         `json:"embeds,omitempty"`
+	AllowedMentions DiscordAllowedMentions `json:"allowed_mentions"`
+}
+
+type DiscordAllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// DiscordEmbed is a rich message part, Color is the RGB value of the colour and Timestamp is in RFC 3339.
+type DiscordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+// DiscordNotifier posts to a Discord webhook, the channel is part of the webhook.
+type DiscordNotifier struct {
+	Webhook string
+}
+
+// Notify posts the overviews as an embed per section, coloured by their severity.
+func (notifier *DiscordNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	return notifier.Send(ctx, OverviewMessage(overviews))
+}
+
+func (notifier *DiscordNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	return notifier.Send(ctx, &Message{
+		Icon:     "⚠️",
+		Schedule: schedule,
+		Title:    "Kon wachtdiensten niet ophalen",
+		Text:     NewText("Kon wachtdiensten niet ophalen uit Nerve Centre: " + message),
+	})
+}
+
+// Send posts the text of message with an embed for every section. Discord accepts ten embeds in a message, so the
+// other embeds are posted in messages of their own.
+func (notifier *DiscordNotifier) Send(ctx context.Context, message *Message) error {
+	embeds := discordEmbeds(message.Sections)
+
+	payload := &DiscordPayload{
+		Username:        message.Username(),
+		Content:         message.Text.String(),
+		AllowedMentions: DiscordAllowedMentions{Parse: []string{}},
+	}
+
+	for {
+		count := len(embeds)
+
+		if count > discordMaxEmbeds {
+			count = discordMaxEmbeds
+		}
+
+		payload.Embeds = embeds[:count]
+		embeds = embeds[count:]
+
+		if err := postJson(ctx, "discord", notifier.Webhook, payload); err != nil {
+			return err
+		}
+
+		if len(embeds) == 0 {
+			return nil
+		}
+
+		payload.Content = ""
+	}
+}
+
+func discordEmbeds(sections []Section) []DiscordEmbed {
+	embeds := make([]DiscordEmbed, 0, len(sections))
+
+	for _, section := range sections {
+		embed := DiscordEmbed{
+			Title:       section.Title,
+			Description: section.Text.String(),
+		}
+
+		if color, err := strconv.ParseInt(strings.TrimPrefix(severityColors[section.Severity], "#"), 16, 32); err == nil {
+			embed.Color = int(color)
+		}
+
+		if !section.Time.IsZero() {
+			embed.Timestamp = section.Time.UTC().Format(time.RFC3339)
+		}
+
+		embeds = append(embeds, embed)
+	}
+
+	return embeds
+}
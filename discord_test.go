@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDiscordNotifier_Notify(t *testing.T) {
+	core, _ := newTestOverviews()
+
+	var payloads []DiscordPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload DiscordPayload
+
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.Embeds) > discordMaxEmbeds {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		payloads = append(payloads, payload)
+
+		// Discord answers without content unless the webhook is called with wait=true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	notifier := &DiscordNotifier{Webhook: ts.URL}
+
+	if err := notifier.Notify(context.Background(), []*Overview{core}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	want := DiscordPayload{
+		Username: "📞 Wachtdienst Core",
+		Content:  "Een overzicht van de de huidige wachtdiensten die zijn ingeregeld voor Core in Nerve Centre",
+		Embeds: []DiscordEmbed{
+			{Title: "Vandaag", Description: "Alice tot 02-01-2021 00:00", Color: 0x007a5a},
+			{Title: "Volgende", Description: "Bob op 02-01-2021 om 00:00", Color: 0xffc917, Timestamp: "2021-01-01T23:00:00Z"},
+			{Title: "Einde rooster", Description: "Er is een rooster tot 03-01-2021 00:00", Color: 0xec0045, Timestamp: "2021-01-02T23:00:00Z"},
+		},
+		AllowedMentions: DiscordAllowedMentions{Parse: []string{}},
+	}
+
+	if len(payloads) != 1 || !reflect.DeepEqual(payloads[0], want) {
+		t.Errorf("Notify() posted %+v, want %+v", payloads, want)
+	}
+
+	payloads = nil
+
+	if err := notifier.Notify(context.Background(), []*Overview{core, core, core, core}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if len(payloads) != 2 || len(payloads[0].Embeds) != 10 || len(payloads[1].Embeds) != 2 || payloads[1].Content != "" {
+		t.Errorf("Notify() of 12 embeds posted %+v, want 10 embeds with the text and 2 without", payloads)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultSmtpPort = 587
+
+// EmailNotifier sends emails through an SMTP server, upgrading the connection with STARTTLS. A server without
+// STARTTLS is only accepted when Config.Insecure is set.
+type EmailNotifier struct {
+	Config EmailConfig
+	// tlsConfig replaces the TLS configuration of STARTTLS, it is set by the tests to trust their server
+	tlsConfig *tls.Config
+}
+
+// emailShift is a row of the table of wachtdiensten, Week is set on the first row of a week.
+type emailShift struct {
+	Week    string
+	Start   string
+	End     string
+	Members string
+}
+
+// emailOverview is an overview as it is shown in an email.
+type emailOverview struct {
+	Title      string
+	Today      string
+	TodayColor string
+	Next       string
+	NextColor  string
+	HasNext    bool
+	RosterEnd  string
+	Shifts     []emailShift
+}
+
+var emailText = template.Must(template.New("text").Parse(`{{range $i, $overview := .}}{{if $i}}
+
+{{end}}{{.Title}}
+
+Vandaag: {{.Today}}{{if .HasNext}}
+Volgende: {{.Next}}{{end}}{{if .RosterEnd}}
+{{.RosterEnd}}{{end}}{{range .Shifts}}{{if .Week}}
+
+{{.Week}}{{end}}
+  {{.Start}} - {{.End}}  {{.Members}}{{end}}{{end}}
+`))
+
+var emailHtml = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px; color: #1d1c1d;">
+{{range .}}<h2>{{.Title}}</h2>
+<p style="border-left: 4px solid {{.TodayColor}}; padding-left: 8px;"><strong>Vandaag</strong><br>{{.Today}}</p>
+{{if .HasNext}}<p style="border-left: 4px solid {{.NextColor}}; padding-left: 8px;"><strong>Volgende</strong><br>{{.Next}}</p>
+{{end}}{{if .RosterEnd}}<p style="color: #616061; font-size: 12px;">{{.RosterEnd}}</p>
+{{end}}{{if .Shifts}}<table style="border-collapse: collapse;">
+<tr><th style="text-align: left; padding: 4px 8px;">Van</th><th style="text-align: left; padding: 4px 8px;">Tot</th><th style="text-align: left; padding: 4px 8px;">Wachtdienst</th></tr>
+{{range .Shifts}}{{if .Week}}<tr><th colspan="3" style="text-align: left; padding: 12px 8px 4px; border-bottom: 1px solid #dddddd;">{{.Week}}</th></tr>
+{{end}}<tr><td style="padding: 4px 8px;">{{.Start}}</td><td style="padding: 4px 8px;">{{.End}}</td><td style="padding: 4px 8px;">{{.Members}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`))
+
+var weekdays = [...]string{"zo", "ma", "di", "wo", "do", "vr", "za"}
+
+// Notify emails the overviews with today, the next wachtdienst and the end of the roster coloured by their severity,
+// followed by a table of every wachtdienst until the end of the roster, grouped by week.
+func (notifier *EmailNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	subject := "Overzicht wachtdiensten"
+
+	if len(overviews) == 1 {
+		subject = "Overzicht wachtdienst " + overviews[0].Schedule.GroupName
+	}
+
+	data := make([]emailOverview, 0, len(overviews))
+
+	for _, overview := range overviews {
+		data = append(data, newEmailOverview(overview))
+	}
+
+	var text bytes.Buffer
+	var html bytes.Buffer
+
+	if err := emailText.Execute(&text, data); err != nil {
+		return err
+	}
+
+	if err := emailHtml.Execute(&html, data); err != nil {
+		return err
+	}
+
+	return notifier.send(ctx, subject, text.String(), html.String())
+}
+
+func newEmailOverview(overview *Overview) emailOverview {
+	data := emailOverview{Title: "Wachtdienst " + overview.Schedule.GroupName, HasNext: overview.Next != nil}
+	today, todaySeverity := overview.today()
+	data.Today, data.TodayColor = today.String(), severityColors[todaySeverity]
+
+	if overview.Next != nil {
+		next, nextSeverity := overview.next()
+		data.Next, data.NextColor = next.String(), severityColors[nextSeverity]
+	}
+
+	if overview.HasRoster {
+		data.RosterEnd = overview.rosterEnd()
+	}
+
+	week := ""
+
+	for _, shift := range overview.Shifts {
+		start := shift.Start.In(overview.Location)
+		row := emailShift{
+			Start:   weekdays[start.Weekday()] + " " + overview.format(shift.Start, "02-01-2006 15:04"),
+			End:     weekdays[shift.End.In(overview.Location).Weekday()] + " " + overview.format(shift.End, "02-01-2006 15:04"),
+			Members: membersString(shift.Members) + backupString(shift.Backup),
+		}
+
+		year, number := start.ISOWeek()
+
+		if current := "Week " + strconv.Itoa(number) + " (" + strconv.Itoa(year) + ")"; current != week {
+			row.Week = current
+			week = current
+		}
+
+		data.Shifts = append(data.Shifts, row)
+	}
+
+	return data
+}
+
+func (notifier *EmailNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	return notifier.send(ctx, "Wachtdienst "+schedule.GroupName+": Kon wachtdiensten niet ophalen", "Kon wachtdiensten niet ophalen uit Nerve Centre: "+message+"\n", "")
+}
+
+// Send emails the text of message followed by the title and text of every section, with the schedule and the title
+// of message as subject.
+func (notifier *EmailNotifier) Send(ctx context.Context, message *Message) error {
+	subject := strings.TrimSpace("Wachtdienst "+message.Schedule.GroupName) + ": " + message.Title
+	lines := []string{message.Text.String()}
+
+	for _, section := range message.Sections {
+		lines = append(lines, "", section.Title+": "+section.Text.String())
+	}
+
+	return notifier.send(ctx, subject, strings.Join(lines, "\n")+"\n", "")
+}
+
+// send emails a message with text, and html as alternative when it is not empty, to every recipient.
+func (notifier *EmailNotifier) send(ctx context.Context, subject string, text string, html string) error {
+	message, err := notifier.message(subject, text, html)
+
+	if err != nil {
+		return err
+	}
+
+	config := notifier.Config
+	port := config.Port
+
+	if port == 0 {
+		port = DefaultSmtpPort
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(config.Host, strconv.Itoa(port)))
+
+	if err != nil {
+		return fmt.Errorf("could not connect to smtp server: %w", err)
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, config.Host)
+
+	if err != nil {
+		return fmt.Errorf("could not connect to smtp server: %w", err)
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := notifier.tlsConfig
+
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: config.Host}
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("could not start tls with smtp server: %w", err)
+		}
+	} else if !config.Insecure {
+		return errors.New("smtp server does not support STARTTLS, set insecure to send without it")
+	}
+
+	if config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return fmt.Errorf("could not authenticate with smtp server: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(config.From)); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+
+	for _, recipient := range config.To {
+		if err := client.Rcpt(address(recipient)); err != nil {
+			return fmt.Errorf("could not send email to %s: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return fmt.Errorf("could not send email: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// message returns the email with its headers, as multipart/alternative when html is set.
+func (notifier *EmailNotifier) message(subject string, text string, html string) ([]byte, error) {
+	var body bytes.Buffer
+
+	headers := []string{
+		"From: " + notifier.Config.From,
+		"To: " + strings.Join(notifier.Config.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageId(notifier.Config.From),
+		"MIME-Version: 1.0",
+	}
+
+	if html == "" {
+		headers = append(headers, "Content-Type: text/plain; charset=utf-8", "Content-Transfer-Encoding: quoted-printable")
+		body.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+		if err := writeQuotedPrintable(&body, text); err != nil {
+			return nil, err
+		}
+
+		return body.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&body)
+	headers = append(headers, "Content-Type: multipart/alternative; boundary="+parts.Boundary())
+	body.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeQuotedPrintable(writer, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	writer := quotedprintable.NewWriter(w)
+
+	if _, err := writer.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n"))); err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// address returns the email address of a recipient like "Jan Jansen <jan@example.com>".
+func address(recipient string) string {
+	if parsed, err := mail.ParseAddress(recipient); err == nil {
+		return parsed.Address
+	}
+
+	return recipient
+}
+
+// messageId returns a unique message id in the domain of the sender.
+func messageId(from string) string {
+	random := make([]byte, 16)
+	rand.Read(random)
+
+	domain := "localhost"
+
+	if at := strings.LastIndex(address(from), "@"); at >= 0 {
+		domain = address(from)[at+1:]
+	}
+
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
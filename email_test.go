@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSmtp is an SMTP server that offers STARTTLS and AUTH PLAIN and remembers the emails it receives.
+type fakeSmtp struct {
+	listener net.Listener
+	tls      *tls.Config
+	done     chan struct{}
+	// Auth is the decoded AUTH PLAIN response, Data the emails received with their envelope
+	Auth       string
+	From       string
+	Recipients []string
+	Data       string
+}
+
+func newFakeSmtp(t *testing.T) (*fakeSmtp, *x509.CertPool) {
+	// The TLS server of httptest brings a certificate for 127.0.0.1 and a pool that trusts it
+	tlsServer := httptest.NewTLSServer(nil)
+	t.Cleanup(tlsServer.Close)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsServer.Certificate())
+
+	server := &fakeSmtp{listener: listener, tls: &tls.Config{Certificates: tlsServer.TLS.Certificates}, done: make(chan struct{})}
+
+	go server.serve()
+
+	return server, roots
+}
+
+func (server *fakeSmtp) port() int {
+	return server.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (server *fakeSmtp) serve() {
+	defer close(server.done)
+
+	conn, err := server.listener.Accept()
+
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	secure := false
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			return
+		}
+
+		command := strings.TrimRight(line, "\r\n")
+
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); {
+		case verb == "EHLO":
+			if secure {
+				reply("250-fake", "250 AUTH PLAIN")
+			} else {
+				reply("250-fake", "250 STARTTLS")
+			}
+		case verb == "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, server.tls)
+
+			if tlsConn.Handshake() != nil {
+				return
+			}
+
+			conn = tlsConn
+			reader = bufio.NewReader(conn)
+			secure = true
+		case verb == "AUTH" && secure:
+			auth, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(command, "AUTH PLAIN "))
+			server.Auth = string(auth)
+			reply("235 ok")
+		case verb == "MAIL":
+			server.From = strings.TrimSuffix(strings.TrimPrefix(command, "MAIL FROM:<"), ">")
+			reply("250 ok")
+		case verb == "RCPT":
+			server.Recipients = append(server.Recipients, strings.TrimSuffix(strings.TrimPrefix(command, "RCPT TO:<"), ">"))
+			reply("250 ok")
+		case verb == "DATA":
+			reply("354 go ahead")
+
+			var data strings.Builder
+
+			for {
+				line, err := reader.ReadString('\n')
+
+				if err != nil || line == ".\r\n" {
+					break
+				}
+
+				data.WriteString(line)
+			}
+
+			server.Data = data.String()
+			reply("250 ok")
+		case verb == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+func TestEmailNotifier_Notify(t *testing.T) {
+	core, platform := newTestOverviews()
+	server, roots := newFakeSmtp(t)
+
+	notifier := &EmailNotifier{
+		Config: EmailConfig{
+			Host:     "127.0.0.1",
+			Port:     server.port(),
+			Username: "bot",
+			Password: "secret",
+			From:     "Wachtdienst <wachtdienst@example.com>",
+			To:       []string{"management@example.com", "Jan Jansen <jan@example.com>"},
+		},
+		tlsConfig: &tls.Config{ServerName: "127.0.0.1", RootCAs: roots},
+	}
+
+	if err := notifier.Notify(context.Background(), []*Overview{core, platform}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	<-server.done
+
+	if server.Auth != "\x00bot\x00secret" {
+		t.Errorf("Notify() authenticated with %q, want bot and secret", server.Auth)
+	}
+
+	if want := []string{"management@example.com", "jan@example.com"}; server.From != "wachtdienst@example.com" || !reflect.DeepEqual(server.Recipients, want) {
+		t.Errorf("Notify() sent from %s to %v, want from wachtdienst@example.com to %v", server.From, server.Recipients, want)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(server.Data))
+
+	if err != nil {
+		t.Fatalf("Notify() sent an invalid email: %v", err)
+	}
+
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); subject != "Overzicht wachtdiensten" {
+		t.Errorf("Notify() subject = %q, want %q", subject, "Overzicht wachtdiensten")
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Notify() content type = %s, want multipart/alternative", mediaType)
+	}
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	contents := make(map[string]string)
+
+	for {
+		// The reader of multipart decodes quoted-printable by itself
+		part, err := parts.NextPart()
+
+		if err != nil {
+			break
+		}
+
+		content, _ := ioutil.ReadAll(part)
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		contents[partType] = strings.ReplaceAll(string(content), "\r\n", "\n")
+	}
+
+	wantText := `Wachtdienst Core
+
+Vandaag: Alice tot 02-01-2021 00:00
+Volgende: Bob op 02-01-2021 om 00:00
+Er is een rooster tot 03-01-2021 00:00
+
+Week 53 (2020)
+  vr 01-01-2021 00:00 - za 02-01-2021 00:00  Alice
+  za 02-01-2021 00:00 - zo 03-01-2021 00:00  Bob
+
+Wachtdienst Platform
+
+Vandaag: <<geen>>
+
+Week 53 (2020)
+  vr 01-01-2021 00:00 - za 02-01-2021 00:00  <<geen>>
+`
+
+	if contents["text/plain"] != wantText {
+		t.Errorf("Notify() text =\n%s\nwant\n%s", contents["text/plain"], wantText)
+	}
+
+	for _, want := range []string{"<h2>Wachtdienst Core</h2>", "&lt;&lt;geen&gt;&gt;", `<th colspan="3"`, "Week 53 (2020)", "#007a5a"} {
+		if !strings.Contains(contents["text/html"], want) {
+			t.Errorf("Notify() html does not contain %s:\n%s", want, contents["text/html"])
+		}
+	}
+}
+
+func TestEmailNotifier_Send(t *testing.T) {
+	server, roots := newFakeSmtp(t)
+
+	notifier := &EmailNotifier{
+		Config: EmailConfig{
+			Host: "127.0.0.1",
+			Port: server.port(),
+			From: "wachtdienst@example.com",
+			To:   []string{"management@example.com"},
+		},
+		tlsConfig: &tls.Config{ServerName: "127.0.0.1", RootCAs: roots},
+	}
+
+	handover := &Handover{
+		Schedule: nervecentre.Schedule{GroupName: "Core"},
+		Location: time.UTC,
+		Outgoing: []string{"Alice"},
+		Incoming: []string{"Bob"},
+		End:      time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+	}
+
+	if err := notifier.Send(context.Background(), handover.Message()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	<-server.done
+
+	message, err := mail.ReadMessage(strings.NewReader(server.Data))
+
+	if err != nil {
+		t.Fatalf("Send() sent an invalid email: %v", err)
+	}
+
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); subject != "Wachtdienst Core: Overdracht" {
+		t.Errorf("Send() subject = %q, want %q", subject, "Wachtdienst Core: Overdracht")
+	}
+
+	body, _ := ioutil.ReadAll(quotedprintable.NewReader(message.Body))
+	want := "Overdracht van de wachtdienst Core: Alice → Bob\n\nUit dienst: Alice\n\nIn dienst: Bob tot 02-01-2021 08:00\n"
+
+	if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != want {
+		t.Errorf("Send() text = %q, want %q", got, want)
+	}
+}
+
+func TestEmailNotifier_RequiresStartTls(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 fake ESMTP\r\n"))
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			if strings.HasPrefix(line, "EHLO") {
+				conn.Write([]byte("250 fake\r\n"))
+			} else {
+				conn.Write([]byte("221 bye\r\n"))
+			}
+		}
+	}()
+
+	notifier := &EmailNotifier{
+		Config: EmailConfig{
+			Host: "127.0.0.1",
+			Port: listener.Addr().(*net.TCPAddr).Port,
+			From: "wachtdienst@example.com",
+			To:   []string{"management@example.com"},
+		},
+	}
+
+	err = notifier.Send(context.Background(), &Message{Icon: "📞", Schedule: nervecentre.Schedule{GroupName: "Core"}, Text: NewText("Hallo")})
+
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send() error = %v, want an error about STARTTLS", err)
+	}
+}
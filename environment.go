@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const environmentPrefix = "NERVE_CENTRE_"
+
+// EnvironmentName returns the environment variable of a flag, for example NERVE_CENTRE_SCHEDULE_TIMEZONE for
+// -schedule-timezone.
+func EnvironmentName(flagName string) string {
+	return environmentPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnvironment sets every flag that was not given on the command line from its environment variable, or from the
+// file named by the same variable with a _FILE suffix. Flags set this way count as set, so they override the
+// configuration file just like command line flags.
+func ApplyEnvironment(flags *flag.FlagSet) error {
+	set := make(map[string]bool)
+
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+
+		name := EnvironmentName(f.Name)
+		value, ok := os.LookupEnv(name)
+
+		if !ok {
+			file, fileOk := os.LookupEnv(name + "_FILE")
+
+			if !fileOk {
+				return
+			}
+
+			content, readErr := ioutil.ReadFile(file)
+
+			if readErr != nil {
+				err = fmt.Errorf("could not read %s_FILE: %w", name, readErr)
+				return
+			}
+
+			// Secret files usually end with a newline that is not part of the secret
+			value = strings.TrimRight(string(content), "\r\n")
+		}
+
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", name, setErr)
+		}
+	})
+
+	return err
+}
+
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		out := flags.Output()
+
+		fmt.Fprintf(out, `Usage: %s [command] [flags]
+
+Commands:
+  run         post the overview once and exit (default)
+  serve       keep running and run the configured jobs on their cron schedule, and serve the calendar and API over HTTP with -listen
+  export ics  write the wachtdiensten within the horizon as iCalendar, to stdout or -output
+
+Flags:
+`, flags.Name())
+		flags.PrintDefaults()
+		fmt.Fprintf(out, `
+Every flag can also be set with an environment variable, for example %s for -password, or with
+the same variable suffixed with _FILE, for example %s_FILE=/run/secrets/password, which reads the
+value from that file. A value is taken from, in order of precedence:
+
+  1. the flag on the command line
+  2. the environment variable
+  3. the file named by the _FILE environment variable
+  4. the configuration file given with -config
+  5. the default of the flag
+`, EnvironmentName("password"), EnvironmentName("password"))
+	}
+}
+
+// Redactor removes secrets, like passwords and webhook urls, from text that leaves the process. It is safe for
+// concurrent use, the HTTP server logs while the runner adds the passwords of the tenants it logs in to.
+type Redactor struct {
+	mutex   sync.RWMutex
+	secrets []string
+}
+
+func (redactor *Redactor) Add(secret string) {
+	if secret == "" {
+		return
+	}
+
+	redactor.mutex.Lock()
+	defer redactor.mutex.Unlock()
+
+	redactor.secrets = append(redactor.secrets, secret)
+
+	// Secrets also end up in urls and forms in their escaped form
+	if escaped := url.QueryEscape(secret); escaped != secret {
+		redactor.secrets = append(redactor.secrets, escaped)
+	}
+}
+
+func (redactor *Redactor) Redact(text string) string {
+	redactor.mutex.RLock()
+	defer redactor.mutex.RUnlock()
+
+	for _, secret := range redactor.secrets {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+
+	return text
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setenv(t *testing.T, name string, value string) {
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		os.Unsetenv(name)
+	})
+}
+
+func TestEnvironmentName(t *testing.T) {
+	tests := []struct {
+		flag string
+		want string
+	}{
+		{
+			flag: "password",
+			want: "NERVE_CENTRE_PASSWORD",
+		},
+		{
+			flag: "schedule-timezone",
+			want: "NERVE_CENTRE_SCHEDULE_TIMEZONE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			if got := EnvironmentName(tt.flag); got != tt.want {
+				t.Errorf("EnvironmentName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	ioutil.WriteFile(secret, []byte("from-file\n"), 0600)
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    string
+		wantSet bool
+		wantErr bool
+	}{
+		{
+			name:    "Nothing set",
+			args:    []string{},
+			env:     map[string]string{},
+			want:    "",
+			wantSet: false,
+		},
+		{
+			name:    "Environment variable",
+			args:    []string{},
+			env:     map[string]string{"NERVE_CENTRE_PASSWORD": "from-env"},
+			want:    "from-env",
+			wantSet: true,
+		},
+		{
+			name:    "File",
+			args:    []string{},
+			env:     map[string]string{"NERVE_CENTRE_PASSWORD_FILE": secret},
+			want:    "from-file",
+			wantSet: true,
+		},
+		{
+			name:    "Environment variable before file",
+			args:    []string{},
+			env:     map[string]string{"NERVE_CENTRE_PASSWORD": "from-env", "NERVE_CENTRE_PASSWORD_FILE": secret},
+			want:    "from-env",
+			wantSet: true,
+		},
+		{
+			name:    "Flag before environment variable",
+			args:    []string{"-password", "from-flag"},
+			env:     map[string]string{"NERVE_CENTRE_PASSWORD": "from-env"},
+			want:    "from-flag",
+			wantSet: true,
+		},
+		{
+			name:    "Missing file",
+			args:    []string{},
+			env:     map[string]string{"NERVE_CENTRE_PASSWORD_FILE": secret + ".missing"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				setenv(t, name, value)
+			}
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			password := flags.String("password", "", "")
+			flags.Parse(tt.args)
+
+			err := ApplyEnvironment(flags)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyEnvironment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			set := false
+			flags.Visit(func(f *flag.Flag) {
+				set = set || f.Name == "password"
+			})
+
+			if *password != tt.want || set != tt.wantSet {
+				t.Errorf("ApplyEnvironment() password = %v, set = %v, want %v, %v", *password, set, tt.want, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	redactor := &Redactor{}
+	redactor.Add("s3cr&t")
+	redactor.Add("https://hooks.slack.com/services/T/B/X")
+	redactor.Add("")
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "Password",
+			text: "login with s3cr&t failed",
+			want: "login with [REDACTED] failed",
+		},
+		{
+			name: "Escaped password",
+			text: "password=s3cr%26t",
+			want: "password=[REDACTED]",
+		},
+		{
+			name: "Webhook",
+			text: `Post "https://hooks.slack.com/services/T/B/X": dial tcp: i/o timeout`,
+			want: `Post "[REDACTED]": dial tcp: i/o timeout`,
+		},
+		{
+			name: "Nothing secret",
+			text: "Nerve Centre returned 500",
+			want: "Nerve Centre returned 500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactor.Redact(tt.text); got != tt.want {
+				t.Errorf("Redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_Concurrent(t *testing.T) {
+	redactor := &Redactor{}
+	done := make(chan struct{})
+
+	// Run with -race, secrets are added while text is redacted
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			redactor.Add(fmt.Sprintf("secret%d", i))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		redactor.Redact("login with secret1 failed")
+	}
+
+	<-done
+
+	if got, want := redactor.Redact("login with secret1 failed"), "login with [REDACTED] failed"; got != want {
+		t.Errorf("Redact() = %v, want %v", got, want)
+	}
+}
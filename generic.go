@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultRequestMethod   = http.MethodPost
+	DefaultSignatureHeader = "X-Signature-256"
+)
+
+const (
+	EventOverview = "overview"
+	EventFailure  = "failure"
+	EventMessage  = "message"
+)
+
+// WebhookData is what the templates of a generic webhook are executed with, the README documents its fields. Event is
+// EventOverview, EventFailure or EventMessage. The overview fields are set for EventOverview, Error for EventFailure
+// and Text and Sections for EventMessage, the messages of the other tasks.
+type WebhookData struct {
+	Event    string
+	Time     time.Time
+	Schedule nervecentre.Schedule
+	// Current is nil when nobody is on call, Next is nil when the roster has no other members after Current
+	Current        *WebhookShift
+	Next           *WebhookShift
+	Shifts         []WebhookShift
+	RosterEnd      *time.Time
+	HorizonReached bool
+	Error          string
+	Text           string
+	Sections       []WebhookSection
+}
+
+type WebhookShift struct {
+	Start   time.Time
+	End     time.Time
+	Members []WebhookMember
+	Backup  []WebhookMember
+}
+
+// WebhookSection is a section of a message, Severity is good, warning or attention.
+type WebhookSection struct {
+	Title    string
+	Text     string
+	Severity Severity
+}
+
+type WebhookMember struct {
+	Id    string
+	Name  string
+	Email string
+}
+
+// webhookFuncs are the functions the templates can use next to the builtin functions of text/template.
+var webhookFuncs = template.FuncMap{
+	// json encodes a value as JSON, for example a string with its quotes or a time in RFC 3339
+	"json": func(value interface{}) (string, error) {
+		body, err := json.Marshal(value)
+		return string(body), err
+	},
+	"join": strings.Join,
+	"names": func(members []WebhookMember) []string {
+		names := make([]string, 0, len(members))
+
+		for _, member := range members {
+			names = append(names, member.Name)
+		}
+
+		return names
+	},
+	"ids": func(members []WebhookMember) []string {
+		ids := make([]string, 0, len(members))
+
+		for _, member := range members {
+			ids = append(ids, member.Id)
+		}
+
+		return ids
+	},
+}
+
+// RequestTemplates are the parsed templates of a RequestConfig.
+type RequestTemplates struct {
+	method  *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+// ParseRequest parses the templates of the method, the body and the headers of request.
+func ParseRequest(request RequestConfig) (*RequestTemplates, error) {
+	method, err := template.New("method").Funcs(webhookFuncs).Parse(request.Method)
+
+	if err != nil {
+		return nil, fmt.Errorf("method: %w", err)
+	}
+
+	body, err := template.New("body").Funcs(webhookFuncs).Parse(request.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	templates := &RequestTemplates{method: method, body: body, headers: make(map[string]*template.Template)}
+
+	for name, value := range request.Headers {
+		header, err := template.New(name).Funcs(webhookFuncs).Parse(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+
+		templates.headers[name] = header
+	}
+
+	return templates, nil
+}
+
+// GenericNotifier sends the data of the messages to Url in the shape defined by the templates of Request. A request
+// is sent for every schedule of a combined overview, nothing is sent when the body is empty.
+type GenericNotifier struct {
+	Url     string
+	Request RequestConfig
+}
+
+func (notifier *GenericNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	for _, overview := range overviews {
+		if err := notifier.send(ctx, NewWebhookData(overview)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (notifier *GenericNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	return notifier.send(ctx, &WebhookData{Event: EventFailure, Time: time.Now(), Schedule: schedule, Error: message})
+}
+
+func (notifier *GenericNotifier) Send(ctx context.Context, message *Message) error {
+	data := &WebhookData{Event: EventMessage, Time: time.Now(), Schedule: message.Schedule, Text: message.Text.String()}
+
+	for _, section := range message.Sections {
+		data.Sections = append(data.Sections, WebhookSection{Title: section.Title, Text: section.Text.String(), Severity: section.Severity})
+	}
+
+	return notifier.send(ctx, data)
+}
+
+// NewWebhookData returns the data of an overview for the templates. The current and next shift match those of the
+// overview in Slack.
+func NewWebhookData(overview *Overview) *WebhookData {
+	data := &WebhookData{
+		Event:          EventOverview,
+		Time:           overview.Time,
+		Schedule:       overview.Schedule,
+		Shifts:         make([]WebhookShift, 0, len(overview.Shifts)),
+		HorizonReached: overview.HorizonReached,
+	}
+
+	if overview.HasRoster {
+		rosterEnd := overview.RosterEnd
+		data.RosterEnd = &rosterEnd
+	}
+
+	for i, shift := range overview.Shifts {
+		data.Shifts = append(data.Shifts, WebhookShift{
+			Start:   shift.Start,
+			End:     shift.End,
+			Members: webhookMembers(shift.MemberList),
+			Backup:  webhookMembers(shift.BackupList),
+		})
+
+		if len(overview.Current) > 0 && !shift.Start.After(overview.Time) && shift.End.After(overview.Time) {
+			data.Current = &data.Shifts[i]
+		}
+
+		if overview.Next != nil && shift.Start.Equal(overview.Next.Start) {
+			data.Next = &data.Shifts[i]
+		}
+	}
+
+	return data
+}
+
+func webhookMembers(members []nervecentre.Member) []WebhookMember {
+	converted := make([]WebhookMember, 0, len(members))
+
+	for _, member := range members {
+		converted = append(converted, WebhookMember{Id: member.UserId, Name: strings.TrimSpace(member.Name), Email: member.Email})
+	}
+
+	return converted
+}
+
+// send renders the request for data and sends it, signing the body when a secret is configured.
+func (notifier *GenericNotifier) send(ctx context.Context, data *WebhookData) error {
+	templates, err := ParseRequest(notifier.Request)
+
+	if err != nil {
+		return fmt.Errorf("invalid request template: %w", err)
+	}
+
+	var body bytes.Buffer
+
+	if err := templates.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("could not render request: %w", err)
+	}
+
+	if strings.TrimSpace(body.String()) == "" {
+		return nil
+	}
+
+	var rendered strings.Builder
+
+	if err := templates.method.Execute(&rendered, data); err != nil {
+		return fmt.Errorf("could not render method: %w", err)
+	}
+
+	method := strings.TrimSpace(rendered.String())
+
+	if method == "" {
+		method = DefaultRequestMethod
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, notifier.Url, bytes.NewReader(body.Bytes()))
+
+	if err != nil {
+		return fmt.Errorf("could not send webhook: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, header := range templates.headers {
+		var value strings.Builder
+
+		if err := header.Execute(&value, data); err != nil {
+			return fmt.Errorf("could not render header %s: %w", name, err)
+		}
+
+		req.Header.Set(name, value.String())
+	}
+
+	if notifier.Request.Secret != "" {
+		signatureHeader := notifier.Request.SignatureHeader
+
+		if signatureHeader == "" {
+			signatureHeader = DefaultSignatureHeader
+		}
+
+		req.Header.Set(signatureHeader, Sign(notifier.Request.Secret, body.Bytes()))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("could not send webhook: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("could not send webhook, service returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the HMAC-SHA256 of body with secret as sha256=<hex>, like the signatures of GitHub webhooks.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
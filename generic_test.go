@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGenericNotifier(t *testing.T) {
+	core, _ := newTestOverviews()
+
+	var requests []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if r.Method != http.MethodPut || r.Header.Get("X-Schedule") != "Core" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !hmac.Equal([]byte(r.Header.Get("X-Signature-256")), []byte(Sign("s3cret", body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request map[string]interface{}
+
+		if err := json.Unmarshal(body, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		requests = append(requests, request)
+	}))
+	defer ts.Close()
+
+	notifier := &GenericNotifier{
+		Url: ts.URL,
+		Request: RequestConfig{
+			Method:  http.MethodPut,
+			Headers: map[string]string{"X-Schedule": "{{.Schedule.GroupName}}"},
+			Body: `{{if eq .Event "overview"}}{
+  "group": {{json .Schedule.GroupId}},
+  "onCall": {{json (ids .Current.Members)}},
+  "names": {{json (join (names .Current.Members) ", ")}},
+  "until": {{json .Current.End}},
+  "next": {{if .Next}}{{json (index .Next.Members 0).Name}}{{else}}null{{end}},
+  "rosterEnd": {{json .RosterEnd}}
+}{{end}}`,
+			Secret: "s3cret",
+		},
+	}
+
+	core.Schedule = nervecentre.Schedule{GroupId: "G1", GroupName: "Core"}
+
+	if err := notifier.Notify(context.Background(), []*Overview{core}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	// The body of other events renders empty, so nothing is sent
+	if err := notifier.Send(context.Background(), &Message{Icon: "📞", Text: NewText("Overdracht")}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	want := []map[string]interface{}{
+		{
+			"group":     "G1",
+			"onCall":    []interface{}{"1"},
+			"names":     "Alice",
+			"until":     "2021-01-02T00:00:00+01:00",
+			"next":      "Bob",
+			"rosterEnd": "2021-01-03T00:00:00+01:00",
+		},
+	}
+
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("GenericNotifier sent %v, want %v", requests, want)
+	}
+}
+
+func TestGenericNotifier_Failure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	notifier := &GenericNotifier{Url: ts.URL, Request: RequestConfig{Body: `{"error": {{json .Error}}}`}}
+
+	if err := notifier.NotifyFailure(context.Background(), nervecentre.Schedule{}, "could not login"); err == nil {
+		t.Errorf("NotifyFailure() error = nil, want an error for status 500")
+	}
+}
+
+func TestGenericNotifier_Method(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		want   []string
+	}{
+		{
+			name: "Default",
+			want: []string{http.MethodPost, http.MethodPost},
+		},
+		{
+			name:   "Template",
+			method: `{{if eq .Event "failure"}}DELETE{{else}}PUT{{end}}`,
+			want:   []string{http.MethodDelete, http.MethodPut},
+		},
+		{
+			name:   "Renders empty",
+			method: `{{if eq .Event "failure"}}PATCH{{end}}`,
+			want:   []string{http.MethodPatch, http.MethodPost},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			methods = nil
+			notifier := &GenericNotifier{Url: ts.URL, Request: RequestConfig{Method: tt.method, Body: `{"event": {{json .Event}}}`}}
+
+			if err := notifier.NotifyFailure(context.Background(), nervecentre.Schedule{}, "could not login"); err != nil {
+				t.Fatalf("NotifyFailure() error = %v", err)
+			}
+
+			if err := notifier.Send(context.Background(), &Message{Icon: "📞", Text: NewText("Overdracht")}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(methods, tt.want) {
+				t.Errorf("GenericNotifier sent %v, want %v", methods, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRequest_InvalidMethod(t *testing.T) {
+	if _, err := ParseRequest(RequestConfig{Method: "{{if .Current}}PUT"}); err == nil {
+		t.Errorf("ParseRequest() error = nil, want an error for the unclosed method template")
+	}
+}
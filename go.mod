@@ -2,4 +2,7 @@ module github.com/robbertnoordzij/nerve-centre-webhook
 
 go 1.16
 
-require 4d63.com/tz v1.2.0
+require (
+	4d63.com/tz v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+	"time"
+)
+
+// Handover compares the members that are on call now with the members that were on call at the previous run.
+type Handover struct {
+	Schedule       nervecentre.Schedule
+	Location       *time.Location
+	Outgoing       []string
+	Incoming       []string
+	IncomingBackup []string
+	// End is the end of the active slot, it is zero when nobody is on call
+	End time.Time
+	// First is set when nothing was seen before, so there is nobody to take over from
+	First bool
+}
+
+func NewHandover(schedule nervecentre.Schedule, users []nervecentre.Member, planning *nervecentre.Planning, runTime time.Time, previous *HandoverState) *Handover {
+	handover := &Handover{
+		Schedule: schedule,
+		Location: runTime.Location(),
+		First:    previous == nil,
+	}
+
+	if previous != nil {
+		handover.Outgoing = previous.Members
+	}
+
+	if planning == nil {
+		return handover
+	}
+
+	slot := planning.GetActiveSlot(runTime)
+
+	if slot != nil {
+		handover.Incoming = slot.GetMembers(users)
+		handover.IncomingBackup = slot.GetBackupMembers(users)
+
+		if len(handover.Incoming) > 0 {
+			handover.End = slot.End
+		}
+	}
+
+	return handover
+}
+
+// Changed reports whether other members are on call than at the previous run.
+func (handover *Handover) Changed() bool {
+	if handover.First {
+		return false
+	}
+
+	if len(handover.Outgoing) == 0 && len(handover.Incoming) == 0 {
+		return false
+	}
+
+	return !Equal(handover.Outgoing, handover.Incoming)
+}
+
+func (handover *Handover) State(runTime time.Time) HandoverState {
+	return HandoverState{Members: handover.Incoming, Seen: runTime}
+}
+
+// Message returns the message announcing the members that took over the wachtdienst.
+func (handover *Handover) Message() *Message {
+	incoming := NewText("<<geen>>")
+	incomingSeverity := SeverityAttention
+
+	if len(handover.Incoming) > 0 {
+		incoming = Text{
+			{Members: handover.Incoming},
+			{Text: " tot " + handover.End.In(handover.Location).Format("02-01-2006 15:04") + backupString(handover.IncomingBackup)},
+		}
+		incomingSeverity = SeverityGood
+	}
+
+	return &Message{
+		Icon:     "📞",
+		Schedule: handover.Schedule,
+		Title:    "Overdracht",
+		Text: Text{
+			{Text: "Overdracht van de wachtdienst " + handover.Schedule.GroupName + ": " + membersString(handover.Outgoing) + " → "},
+			{Members: handover.Incoming, Text: "<<geen>>"},
+		},
+		Sections: []Section{
+			{
+				Title:    "Uit dienst",
+				Text:     NewText(membersString(handover.Outgoing)),
+				Severity: SeverityWarning,
+			},
+			{
+				Title:    "In dienst",
+				Text:     incoming,
+				Severity: incomingSeverity,
+				Time:     handover.End,
+			},
+		},
+	}
+}
+
+func membersString(members []string) string {
+	if len(members) == 0 {
+		return "<<geen>>"
+	}
+
+	return strings.Join(members, ", ")
+}
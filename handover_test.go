@@ -0,0 +1,122 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewHandover(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{
+			UserId: "1",
+			Name:   "Alice",
+		},
+		{
+			UserId: "2",
+			Name:   "Bob",
+		},
+	}
+	planning := &nervecentre.Planning{
+		BaseTimeSlots: []nervecentre.Slot{
+			{
+				Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, loc),
+				End:     time.Date(2021, 1, 1, 8, 0, 0, 0, loc),
+				Members: []string{"1"},
+			},
+			{
+				Start:   time.Date(2021, 1, 1, 8, 0, 0, 0, loc),
+				End:     time.Date(2021, 1, 1, 17, 0, 0, 0, loc),
+				Members: []string{"2"},
+			},
+			{
+				Start: time.Date(2021, 1, 1, 17, 0, 0, 0, loc),
+				End:   time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		runTime      time.Time
+		previous     *HandoverState
+		wantIncoming []string
+		wantChanged  bool
+	}{
+		{
+			name:         "First run",
+			runTime:      time.Date(2021, 1, 1, 9, 0, 0, 0, loc),
+			previous:     nil,
+			wantIncoming: []string{"Bob"},
+			wantChanged:  false,
+		},
+		{
+			name:         "Same members",
+			runTime:      time.Date(2021, 1, 1, 9, 0, 0, 0, loc),
+			previous:     &HandoverState{Members: []string{"Bob"}},
+			wantIncoming: []string{"Bob"},
+			wantChanged:  false,
+		},
+		{
+			name:         "Handover",
+			runTime:      time.Date(2021, 1, 1, 9, 0, 0, 0, loc),
+			previous:     &HandoverState{Members: []string{"Alice"}},
+			wantIncoming: []string{"Bob"},
+			wantChanged:  true,
+		},
+		{
+			name:         "Nobody takes over",
+			runTime:      time.Date(2021, 1, 1, 18, 0, 0, 0, loc),
+			previous:     &HandoverState{Members: []string{"Bob"}},
+			wantIncoming: []string{},
+			wantChanged:  true,
+		},
+		{
+			name:         "Still nobody",
+			runTime:      time.Date(2021, 1, 1, 19, 0, 0, 0, loc),
+			previous:     &HandoverState{Members: nil},
+			wantIncoming: []string{},
+			wantChanged:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handover := NewHandover(nervecentre.Schedule{GroupName: "Core"}, users, planning, tt.runTime, tt.previous)
+			if len(handover.Incoming) != len(tt.wantIncoming) || (len(tt.wantIncoming) > 0 && !Equal(handover.Incoming, tt.wantIncoming)) {
+				t.Errorf("NewHandover() incoming = %v, want %v", handover.Incoming, tt.wantIncoming)
+			}
+			if got := handover.Changed(); got != tt.wantChanged {
+				t.Errorf("Changed() = %v, want %v", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestHandover_Message(t *testing.T) {
+	handover := &Handover{
+		Schedule: nervecentre.Schedule{GroupName: "Core"},
+		Location: time.UTC,
+		Outgoing: []string{"Alice"},
+		Incoming: []string{"Bob", "Carol"},
+		End:      time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+	}
+	message := handover.Message()
+
+	want := "Overdracht van de wachtdienst Core: Alice → <@U2>, Carol"
+
+	if got := message.Text.Render(map[string]string{"Bob": "<@U2>"}); got != want {
+		t.Errorf("Message() text = %v, want %v", got, want)
+	}
+
+	want = "Bob, Carol tot 02-01-2021 08:00"
+
+	if got := message.Sections[1].Text.String(); got != want || message.Sections[1].Severity != SeverityGood {
+		t.Errorf("Message() in dienst = %v (%s), want %v (good)", got, message.Sections[1].Severity, want)
+	}
+
+	if got := message.Names(); !reflect.DeepEqual(got, []string{"Bob", "Carol", "Bob", "Carol"}) {
+		t.Errorf("Names() = %v, want the incoming members of the text and the section", got)
+	}
+}
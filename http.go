@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HttpServer serves the wachtdiensten in the roster cache over HTTP:
+//
+//	GET /calendar.ics                            every schedule as iCalendar feed
+//	GET /calendar.ics?group=Core                 a single schedule, by group id or name
+//	GET /calendar.ics?member=Alice               the wachtdiensten of a member, by user id, name or email address
+//	GET /v1/schedules                            the schedules as JSON
+//	GET /v1/schedules/{groupId}/oncall?at=       the slot at a time, now when at is empty
+//	GET /v1/schedules/{groupId}/slots?from=&to=  the slots between two times, from now until the end of the roster by default
+type HttpServer struct {
+	cache *RosterCache
+	token string
+	mux   *http.ServeMux
+	// now returns the current time, it is replaced by the tests
+	now func() time.Time
+}
+
+func NewHttpServer(cache *RosterCache, config HttpConfig) *HttpServer {
+	server := &HttpServer{
+		cache: cache,
+		token: config.Token,
+		mux:   http.NewServeMux(),
+		now:   time.Now,
+	}
+
+	server.mux.HandleFunc("/calendar.ics", server.handleCalendar)
+	server.mux.HandleFunc("/v1/schedules", server.handleSchedules)
+	server.mux.HandleFunc("/v1/schedules/", server.handleSchedule)
+
+	return server
+}
+
+func (server *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !server.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	server.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r passes the token as bearer token or in the token query parameter. Calendar clients
+// cannot send headers, so they subscribe to a url with the token in it.
+func (server *HttpServer) authorized(r *http.Request) bool {
+	if server.token == "" {
+		return true
+	}
+
+	token := r.URL.Query().Get("token")
+
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(server.token)) == 1
+}
+
+// rosters returns the cached rosters, setting Last-Modified to when they were fetched. When they are not loaded yet
+// the request is answered with 503 and false is returned.
+func (server *HttpServer) rosters(w http.ResponseWriter, r *http.Request) ([]Roster, bool) {
+	rosters, refreshed, err := server.cache.Rosters()
+
+	if err != nil {
+		w.Header().Set("Retry-After", "10")
+		httpError(w, r, http.StatusServiceUnavailable, err.Error())
+		return nil, false
+	}
+
+	w.Header().Set("Last-Modified", refreshed.UTC().Format(http.TimeFormat))
+
+	return rosters, true
+}
+
+func (server *HttpServer) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	rosters, ok := server.rosters(w, r)
+
+	if !ok {
+		return
+	}
+
+	now := server.now()
+	calendar, err := NewCalendar(rosters, now).Filter(r.URL.Query().Get("group"), r.URL.Query().Get("member"))
+
+	if err != nil {
+		httpError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var ics bytes.Buffer
+
+	if err := calendar.WriteIcs(&ics, now); err != nil {
+		httpError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(ics.Bytes())
+}
+
+// httpError answers r with status and message, as JSON for the API and as text otherwise.
+func httpError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		http.Error(w, message, status)
+		return
+	}
+
+	writeJson(w, status, ApiError{Error: message})
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	encoded, err := json.Marshal(body)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(encoded, '\n'))
+}
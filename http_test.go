@@ -0,0 +1,386 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRosters returns the rosters of Core and Platform of namespace acme and of Core of namespace other, from
+// 2021-01-01 until 2021-01-04. In Core of acme Alice is on call on the first day, with Carol taking over in the
+// evening, and Bob on the second day. Nobody is on call for Platform.
+func newTestRosters() []Roster {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{UserId: "1", Name: "Alice", Email: "alice@example.com"},
+		{UserId: "2", Name: "Bob"},
+		{UserId: "3", Name: "Carol"},
+	}
+	at := func(day int, hour int) time.Time {
+		return time.Date(2021, 1, day, hour, 0, 0, 0, loc)
+	}
+	roster := func(namespace string, schedule nervecentre.Schedule, plannings ...*nervecentre.Planning) Roster {
+		return Roster{
+			Namespace: namespace,
+			Schedule:  schedule,
+			Location:  loc,
+			Users:     users,
+			Plannings: plannings,
+			From:      at(1, 0),
+			To:        at(4, 0),
+		}
+	}
+	core := []*nervecentre.Planning{
+		{
+			BaseTimeSlots:    []nervecentre.Slot{{Start: at(1, 0), End: at(2, 0), Members: []string{"1"}}},
+			PrimaryTimeSlots: []nervecentre.Slot{{Start: at(1, 18), End: at(2, 0), Members: []string{"3"}}},
+		},
+		{
+			// The planning of a day can return the last slot of the day before again
+			BaseTimeSlots: []nervecentre.Slot{
+				{Start: at(1, 0), End: at(2, 0), Members: []string{"1"}},
+				{Start: at(2, 0), End: at(3, 0), Members: []string{"2"}},
+			},
+		},
+	}
+
+	return []Roster{
+		roster("acme", nervecentre.Schedule{GroupId: "G1", GroupName: "Core"}, core...),
+		roster("acme", nervecentre.Schedule{GroupId: "G2", GroupName: "Platform"}, &nervecentre.Planning{
+			BaseTimeSlots: []nervecentre.Slot{{Start: at(1, 0), End: at(2, 0)}},
+		}),
+		roster("other", nervecentre.Schedule{GroupId: "G1", GroupName: "Core"}, core...),
+	}
+}
+
+// newTestHttpServer returns a server with rosters in its cache, or an empty cache when rosters is nil, at
+// 2021-01-01 12:00 with token secret.
+func newTestHttpServer(rosters []Roster) *HttpServer {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, loc)
+
+	cache := NewRosterCache(nil, 0)
+
+	if rosters != nil {
+		cache.tenants = []*tenantRosters{{rosters: rosters, refreshed: now.Add(-time.Minute)}}
+	}
+
+	server := NewHttpServer(cache, HttpConfig{Token: "secret"})
+	server.now = func() time.Time { return now }
+
+	return server
+}
+
+func request(t *testing.T, server *HttpServer, method string, target string, header string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, nil)
+
+	if header != "" {
+		r.Header.Set("Authorization", header)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestHttpServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		notLoaded  bool
+		method     string
+		target     string
+		header     string
+		wantStatus int
+		wantType   string
+		want       []string
+	}{
+		{
+			name:       "Calendar without token",
+			target:     "/calendar.ics",
+			wantStatus: http.StatusUnauthorized,
+			want:       []string{"unauthorized\n"},
+		},
+		{
+			name:       "API with wrong token",
+			target:     "/v1/schedules?token=guess",
+			wantStatus: http.StatusUnauthorized,
+			wantType:   "application/json",
+			want:       []string{`{"error":"unauthorized"}`},
+		},
+		{
+			name:       "Bearer token",
+			target:     "/v1/schedules",
+			header:     "Bearer secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Post",
+			method:     http.MethodPost,
+			target:     "/v1/schedules?token=secret",
+			wantStatus: http.StatusMethodNotAllowed,
+			want:       []string{`{"error":"method not allowed"}`},
+		},
+		{
+			name:       "Not loaded yet",
+			notLoaded:  true,
+			target:     "/v1/schedules/G1/oncall?token=secret",
+			wantStatus: http.StatusServiceUnavailable,
+			want:       []string{`{"error":"the rosters are not loaded yet"}`},
+		},
+		{
+			name:       "Calendar not loaded yet",
+			notLoaded:  true,
+			target:     "/calendar.ics?token=secret",
+			wantStatus: http.StatusServiceUnavailable,
+			want:       []string{"the rosters are not loaded yet\n"},
+		},
+		{
+			name:       "Schedules not loaded yet",
+			notLoaded:  true,
+			target:     "/v1/schedules?token=secret",
+			wantStatus: http.StatusServiceUnavailable,
+			want:       []string{`{"error":"the rosters are not loaded yet"}`},
+		},
+		{
+			name:       "Calendar",
+			target:     "/calendar.ics?token=secret",
+			wantStatus: http.StatusOK,
+			wantType:   "text/calendar; charset=utf-8",
+			want: []string{
+				"X-WR-CALNAME:Wachtdienst\r\n",
+				"UID:acme-G1-20201231T230000Z@nerve-centre-webhook\r\n",
+				"UID:other-G1-20201231T230000Z@nerve-centre-webhook\r\n",
+				"SUMMARY:Wachtdienst Core: Carol\r\nDESCRIPTION:Wachtdienst: Carol\\nReserve: Alice\r\n",
+			},
+		},
+		{
+			name:       "Calendar of a member",
+			target:     "/calendar.ics?token=secret&member=bob",
+			wantStatus: http.StatusOK,
+			want:       []string{"X-WR-CALNAME:Wachtdienst Bob\r\n", "SUMMARY:Wachtdienst Core: Bob\r\n"},
+		},
+		{
+			name:       "Calendar of an unknown member",
+			target:     "/calendar.ics?token=secret&member=Dave",
+			wantStatus: http.StatusNotFound,
+			want:       []string{"no member found for \"Dave\"\n"},
+		},
+		{
+			name:       "Schedules",
+			target:     "/v1/schedules?token=secret",
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+			want: []string{
+				`{"schedules":[{"namespace":"acme","groupId":"G1","groupName":"Core","timezone":"Europe/Amsterdam","rosterFrom":"2021-01-01T00:00:00+01:00","rosterTo":"2021-01-04T00:00:00+01:00"},`,
+				`{"namespace":"other","groupId":"G1"`,
+			},
+		},
+		{
+			name:       "On call now",
+			target:     "/v1/schedules/G1/oncall?token=secret&namespace=acme",
+			wantStatus: http.StatusOK,
+			want: []string{
+				`"at":"2021-01-01T12:00:00+01:00","slot":{"start":"2021-01-01T00:00:00+01:00","end":"2021-01-01T18:00:00+01:00","members":[{"id":"1","name":"Alice","email":"alice@example.com"}],"backup":[]}}`,
+			},
+		},
+		{
+			name:       "On call at a time",
+			target:     "/v1/schedules/G1/oncall?token=secret&namespace=acme&at=2021-01-01T20:00:00Z",
+			wantStatus: http.StatusOK,
+			want: []string{
+				`"at":"2021-01-01T21:00:00+01:00","slot":{"start":"2021-01-01T18:00:00+01:00","end":"2021-01-02T00:00:00+01:00","members":[{"id":"3","name":"Carol"}],"backup":[{"id":"1","name":"Alice","email":"alice@example.com"}]}}`,
+			},
+		},
+		{
+			name:       "On call after the end of the roster",
+			target:     "/v1/schedules/platform/oncall?token=secret&at=2021-01-03",
+			wantStatus: http.StatusOK,
+			want:       []string{`"groupName":"Platform"`, `"at":"2021-01-03T00:00:00+01:00","slot":null}`},
+		},
+		{
+			name:       "On call outside of the cache",
+			target:     "/v1/schedules/G2/oncall?token=secret&at=2021-01-04",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"at is outside of the roster from 2021-01-01T00:00:00+01:00 to 2021-01-04T00:00:00+01:00"}`},
+		},
+		{
+			name:       "On call at an invalid time",
+			target:     "/v1/schedules/G2/oncall?token=secret&at=tomorrow",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"invalid at: \"tomorrow\" is not a time like 2021-01-01T08:00:00+01:00 or a date like 2021-01-01"}`},
+		},
+		{
+			name:       "Schedule in several namespaces",
+			target:     "/v1/schedules/G1/oncall?token=secret",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"several schedules match \"G1\", set namespace to choose one"}`},
+		},
+		{
+			name:       "Unknown schedule",
+			target:     "/v1/schedules/G3/slots?token=secret",
+			wantStatus: http.StatusNotFound,
+			want:       []string{`{"error":"no schedule found for group \"G3\""}`},
+		},
+		{
+			name:       "Unknown endpoint",
+			target:     "/v1/schedules/G1/members?token=secret",
+			wantStatus: http.StatusNotFound,
+			want:       []string{`{"error":"not found"}`},
+		},
+		{
+			name:       "Slots until the end of the roster",
+			target:     "/v1/schedules/G1/slots?token=secret&namespace=acme",
+			wantStatus: http.StatusOK,
+			want: []string{
+				`"from":"2021-01-01T12:00:00+01:00","to":"2021-01-04T00:00:00+01:00","slots":[`,
+				`{"start":"2021-01-01T00:00:00+01:00","end":"2021-01-01T18:00:00+01:00","members":[{"id":"1","name":"Alice","email":"alice@example.com"}],"backup":[]},`,
+				`{"start":"2021-01-01T18:00:00+01:00","end":"2021-01-02T00:00:00+01:00","members":[{"id":"3","name":"Carol"}],"backup":[{"id":"1","name":"Alice","email":"alice@example.com"}]},`,
+				`{"start":"2021-01-02T00:00:00+01:00","end":"2021-01-03T00:00:00+01:00","members":[{"id":"2","name":"Bob"}],"backup":[]}]}`,
+			},
+		},
+		{
+			name:       "Slots between two times",
+			target:     "/v1/schedules/Core/slots?token=secret&namespace=other&from=2021-01-01T19:00:00%2B01:00&to=2021-01-02",
+			wantStatus: http.StatusOK,
+			want:       []string{`"slots":[{"start":"2021-01-01T18:00:00+01:00","end":"2021-01-02T00:00:00+01:00","members":[{"id":"3"`},
+		},
+		{
+			name:       "Slots with an invalid from",
+			target:     "/v1/schedules/G2/slots?token=secret&from=1609459200",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"invalid from: `},
+		},
+		{
+			name:       "Slots with an invalid to",
+			target:     "/v1/schedules/G2/slots?token=secret&to=2021-13-01",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"invalid to: `},
+		},
+		{
+			name:       "Slots from after to",
+			target:     "/v1/schedules/G2/slots?token=secret&from=2021-01-02&to=2021-01-01",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`{"error":"from must be before to"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rosters := newTestRosters()
+			if tt.notLoaded {
+				rosters = nil
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := request(t, newTestHttpServer(rosters), method, tt.target, tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("%s %s = %d, want %d: %s", method, tt.target, w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("%s %s content type = %s, want %s", method, tt.target, w.Header().Get("Content-Type"), tt.wantType)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("%s %s does not contain %s:\n%s", method, tt.target, want, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestHttpServer_UniqueUids(t *testing.T) {
+	w := request(t, newTestHttpServer(newTestRosters()), http.MethodGet, "/calendar.ics", "Bearer secret")
+	uids := make(map[string]bool)
+
+	for _, line := range strings.Split(w.Body.String(), "\r\n") {
+		if !strings.HasPrefix(line, "UID:") {
+			continue
+		}
+
+		if uids[line] {
+			t.Errorf("GET /calendar.ics has %s more than once", line)
+		}
+
+		uids[line] = true
+	}
+
+	if len(uids) != 6 {
+		t.Errorf("GET /calendar.ics has %d events, want 6:\n%s", len(uids), w.Body)
+	}
+}
+
+func TestHttpServer_LastModified(t *testing.T) {
+	w := request(t, newTestHttpServer(newTestRosters()), http.MethodGet, "/v1/schedules", "Bearer secret")
+
+	if want := "Fri, 01 Jan 2021 10:59:00 GMT"; w.Header().Get("Last-Modified") != want {
+		t.Errorf("Last-Modified = %s, want %s", w.Header().Get("Last-Modified"), want)
+	}
+}
+
+func TestHttpServer_WithoutToken(t *testing.T) {
+	server := newTestHttpServer(newTestRosters())
+	server.token = ""
+
+	if w := request(t, server, http.MethodGet, "/v1/schedules", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /v1/schedules without token = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHttpServer_DayWithoutMembers(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-03": {"2"},
+	})
+	defer nerveCentre.Close()
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Horizon = 3
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, loc)
+	cache := NewRosterCache(NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false), time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	server := NewHttpServer(cache, HttpConfig{Token: "secret"})
+	server.now = func() time.Time { return now }
+
+	// The roster continues after the day without members
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{
+			target: "/v1/schedules/Core/oncall?token=secret&at=2021-01-03T12:00:00%2B01:00",
+			want:   []string{`"rosterTo":"2021-01-04T00:00:00+01:00"`, `"name":"Bob"`},
+		},
+		{
+			target: "/v1/schedules/Core/slots?token=secret",
+			want:   []string{`"name":"Alice"`, `"start":"2021-01-03T00:00:00+01:00"`, `"name":"Bob"`},
+		},
+	}
+	for _, tt := range tests {
+		w := request(t, server, http.MethodGet, tt.target, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want %d: %s", tt.target, w.Code, http.StatusOK, w.Body)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("GET %s does not contain %s:\n%s", tt.target, want, w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsMaxLineLength is the number of octets after which RFC 5545 folds a content line.
+const icsMaxLineLength = 75
+
+// Calendar holds the wachtdiensten of schedules as events, to export them as an iCalendar feed.
+type Calendar struct {
+	Name      string
+	Events    []CalendarEvent
+	Schedules []nervecentre.Schedule
+	// Users are the members of the schedules, also those without a wachtdienst
+	Users []nervecentre.Member
+}
+
+// CalendarEvent is a wachtdienst of a schedule. Its Uid only depends on the schedule and the start of the shift, so a
+// calendar client updates the event when its members or end change.
+type CalendarEvent struct {
+	Uid      string
+	Schedule nervecentre.Schedule
+	Shift    Shift
+}
+
+// NewCalendarEvents returns an event for every shift of overview in which someone is on call. The start of a shift that
+// started before the plannings of the overview must be set by the caller, see shiftStart.
+func NewCalendarEvents(namespace string, overview *Overview) []CalendarEvent {
+	events := make([]CalendarEvent, 0, len(overview.Shifts))
+
+	for _, shift := range overview.Shifts {
+		if len(shift.MemberList) == 0 {
+			continue
+		}
+
+		events = append(events, CalendarEvent{
+			Uid:      fmt.Sprintf("%s-%s-%s@nerve-centre-webhook", namespace, overview.Schedule.GroupId, shift.Start.UTC().Format("20060102T150405Z")),
+			Schedule: overview.Schedule,
+			Shift:    shift,
+		})
+	}
+
+	return events
+}
+
+// shiftStart returns when the members on call at t went on call: the start of the slot at t, or of the slots directly
+// before it with the same members and backup. ok is false when nobody is on call at t.
+func shiftStart(slots []nervecentre.Slot, users []nervecentre.Member, t time.Time) (start time.Time, ok bool) {
+	for i := len(slots) - 1; i >= 0; i-- {
+		slot := slots[i]
+
+		if !ok {
+			if slot.Start.After(t) || !slot.End.After(t) {
+				continue
+			}
+
+			if len(slot.GetMembers(users)) == 0 {
+				return t, false
+			}
+
+			start, ok = slot.Start, true
+			continue
+		}
+
+		if !slot.End.Equal(start) || !Equal(slot.GetMembers(users), slots[i+1].GetMembers(users)) ||
+			!Equal(slot.GetBackupMembers(users), slots[i+1].GetBackupMembers(users)) {
+			break
+		}
+
+		start = slot.Start
+	}
+
+	return start, ok
+}
+
+// Calendar returns the wachtdiensten of every schedule from runTime until the end of the horizon. Unlike the tasks it
+// stops at the first error and returns it instead of reporting it to the destinations.
+func (runner *Runner) Calendar(ctx context.Context, runTime time.Time) (*Calendar, error) {
+	rosters, err := runner.Rosters(ctx, runTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCalendar(rosters, runTime), nil
+}
+
+// NewCalendar returns the wachtdiensten of the rosters from runTime on. A wachtdienst that started before the roster
+// starts when it started, so it keeps its start and Uid however late the calendar is made.
+func NewCalendar(rosters []Roster, runTime time.Time) *Calendar {
+	calendar := &Calendar{Name: "Wachtdienst"}
+
+	for _, roster := range rosters {
+		overview := NewOverview(roster.Schedule, roster.Users, roster.Plannings, runTime.In(roster.Location))
+
+		if len(overview.Shifts) > 0 {
+			slots := nervecentre.EffectiveSlots(append(append([]*nervecentre.Planning{}, roster.Earlier...), roster.Plannings...))
+
+			if start, ok := shiftStart(slots, roster.Users, overview.Shifts[0].Start); ok {
+				overview.Shifts[0].Start = start
+			}
+		}
+
+		calendar.Events = append(calendar.Events, NewCalendarEvents(roster.Namespace, overview)...)
+		calendar.Schedules = append(calendar.Schedules, roster.Schedule)
+		calendar.Users = append(calendar.Users, roster.Users...)
+	}
+
+	return calendar
+}
+
+// Filter returns the events of the schedules with group id or name group, and of those the events in which member,
+// a user id, name or email address, is on call. Empty arguments do not filter. An error is returned when no schedule
+// or member matches, so a mistake does not look like an empty roster.
+func (calendar *Calendar) Filter(group string, member string) (*Calendar, error) {
+	schedules := FilterSchedules(calendar.Schedules, group)
+
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("no schedule found for group %q", group)
+	}
+
+	filtered := &Calendar{Name: calendar.Name, Schedules: schedules, Users: calendar.Users}
+
+	if group != "" {
+		filtered.Name = "Wachtdienst " + schedules[0].GroupName
+	}
+
+	var user *nervecentre.Member
+
+	if member != "" {
+		for i := range calendar.Users {
+			if matchesMember(calendar.Users[i], member) {
+				user = &calendar.Users[i]
+				break
+			}
+		}
+
+		if user == nil {
+			return nil, fmt.Errorf("no member found for %q", member)
+		}
+
+		filtered.Name = "Wachtdienst " + strings.TrimSpace(user.Name)
+	}
+
+	for _, event := range calendar.Events {
+		if len(FilterSchedules([]nervecentre.Schedule{event.Schedule}, group)) == 0 {
+			continue
+		}
+
+		if user == nil || event.onCall(*user) {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+
+	return filtered, nil
+}
+
+// onCall reports whether member is on call during the event, being a backup does not count.
+func (event CalendarEvent) onCall(member nervecentre.Member) bool {
+	for _, onCall := range event.Shift.MemberList {
+		if onCall.UserId == member.UserId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesMember reports whether key is the user id, name or email address of member, ignoring case.
+func matchesMember(member nervecentre.Member, key string) bool {
+	key = strings.TrimSpace(key)
+
+	for _, value := range []string{member.UserId, member.Name, member.Email} {
+		if value != "" && strings.EqualFold(strings.TrimSpace(value), key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteIcs writes the calendar as an RFC 5545 iCalendar with stamp as the time it was made. The times of the events
+// are in the timezone of their schedule, which is described by a VTIMEZONE covering the events.
+func (calendar *Calendar) WriteIcs(w io.Writer, stamp time.Time) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//nerve-centre-webhook//Wachtdienst//NL",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeText(calendar.Name),
+	}
+
+	locations := calendar.locations()
+
+	if len(locations) == 1 {
+		lines = append(lines, "X-WR-TIMEZONE:"+locations[0].location.String())
+	}
+
+	for _, location := range locations {
+		lines = append(lines, vtimezone(location.location, location.from, location.to)...)
+	}
+
+	for _, event := range calendar.Events {
+		description := "Wachtdienst: " + strings.Join(event.Shift.Members, ", ")
+
+		if len(event.Shift.Backup) > 0 {
+			description += "\nReserve: " + strings.Join(event.Shift.Backup, ", ")
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+event.Uid,
+			"DTSTAMP:"+stamp.UTC().Format("20060102T150405Z"),
+			"DTSTART"+icsTime(event.Shift.Start),
+			"DTEND"+icsTime(event.Shift.End),
+			"SUMMARY:"+escapeText("Wachtdienst "+event.Schedule.GroupName+": "+strings.Join(event.Shift.Members, ", ")),
+			"DESCRIPTION:"+escapeText(description),
+			// A wachtdienst does not make its members busy for other appointments
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	var ics strings.Builder
+
+	for _, line := range lines {
+		ics.WriteString(foldLine(line) + "\r\n")
+	}
+
+	_, err := io.WriteString(w, ics.String())
+
+	return err
+}
+
+// calendarLocation is a timezone used by the events of a calendar, with the range of time they cover.
+type calendarLocation struct {
+	location *time.Location
+	from     time.Time
+	to       time.Time
+}
+
+// locations returns the timezones of the events other than UTC, sorted by name.
+func (calendar *Calendar) locations() []calendarLocation {
+	byName := make(map[string]*calendarLocation)
+
+	for _, event := range calendar.Events {
+		location := event.Shift.Start.Location()
+
+		if location == time.UTC {
+			continue
+		}
+
+		covered, ok := byName[location.String()]
+
+		if !ok {
+			byName[location.String()] = &calendarLocation{location: location, from: event.Shift.Start, to: event.Shift.End}
+			continue
+		}
+
+		if event.Shift.Start.Before(covered.from) {
+			covered.from = event.Shift.Start
+		}
+
+		if event.Shift.End.After(covered.to) {
+			covered.to = event.Shift.End
+		}
+	}
+
+	locations := make([]calendarLocation, 0, len(byName))
+
+	for _, location := range byName {
+		locations = append(locations, *location)
+	}
+
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].location.String() < locations[j].location.String()
+	})
+
+	return locations
+}
+
+// icsTime returns the parameters and value of a date-time property, in UTC or local time with the TZID of its location.
+func icsTime(t time.Time) string {
+	if t.Location() == time.UTC {
+		return ":" + t.Format("20060102T150405Z")
+	}
+
+	return ";TZID=" + t.Location().String() + ":" + t.Format("20060102T150405")
+}
+
+// vtimezone returns a VTIMEZONE of location with an observance for its offset at from and for every transition until
+// to. Observances with a larger offset than the standard time of the year of from are daylight saving time.
+func vtimezone(location *time.Location, from time.Time, to time.Time) []string {
+	from = from.In(location)
+	_, january := time.Date(from.Year(), time.January, 1, 0, 0, 0, 0, location).Zone()
+	_, july := time.Date(from.Year(), time.July, 1, 0, 0, 0, 0, location).Zone()
+	standard := january
+
+	if july < standard {
+		standard = july
+	}
+
+	name, offset := from.Zone()
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + location.String()}
+	lines = append(lines, observance(from, name, offset, offset, standard)...)
+
+	for _, transition := range transitions(location, from, to) {
+		name, next := transition.Zone()
+		// The onset is the local time just before the transition
+		lines = append(lines, observance(transition.In(time.FixedZone("", offset)), name, offset, next, standard)...)
+		offset = next
+	}
+
+	return append(lines, "END:VTIMEZONE")
+}
+
+func observance(start time.Time, name string, from int, to int, standard int) []string {
+	component := "STANDARD"
+
+	if to > standard {
+		component = "DAYLIGHT"
+	}
+
+	return []string{
+		"BEGIN:" + component,
+		"DTSTART:" + start.Format("20060102T150405"),
+		"TZOFFSETFROM:" + utcOffset(from),
+		"TZOFFSETTO:" + utcOffset(to),
+		"TZNAME:" + name,
+		"END:" + component,
+	}
+}
+
+// transitions returns the instants between from and to at which the offset of location changes. The offset is checked
+// every day, a change is searched to the second.
+func transitions(location *time.Location, from time.Time, to time.Time) []time.Time {
+	found := make([]time.Time, 0)
+	_, offset := from.In(location).Zone()
+
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+
+		if _, nextOffset := next.In(location).Zone(); nextOffset == offset {
+			continue
+		}
+
+		before, after := day, next
+
+		for after.Sub(before) > time.Second {
+			middle := before.Add(after.Sub(before) / 2).Truncate(time.Second)
+
+			if _, middleOffset := middle.In(location).Zone(); middleOffset == offset {
+				before = middle
+			} else {
+				after = middle
+			}
+		}
+
+		found = append(found, after.In(location))
+		_, offset = after.In(location).Zone()
+	}
+
+	return found
+}
+
+// utcOffset formats an offset in seconds east of UTC like +0100.
+func utcOffset(offset int) string {
+	sign := "+"
+
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	formatted := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+
+	if offset%60 != 0 {
+		formatted += fmt.Sprintf("%02d", offset%60)
+	}
+
+	return formatted
+}
+
+// escapeText escapes a TEXT value of RFC 5545.
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldLine splits a content line into lines of at most 75 octets, continued lines start with a space. Lines are only
+// split between characters, never within a UTF-8 sequence.
+func foldLine(line string) string {
+	if len(line) <= icsMaxLineLength {
+		return line
+	}
+
+	var folded strings.Builder
+	length := 0
+
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+
+		if length+size > icsMaxLineLength {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(r)
+		length += size
+	}
+
+	return folded.String()
+}
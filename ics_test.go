@@ -0,0 +1,233 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"bytes"
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCalendar() *Calendar {
+	core, platform := newTestOverviews()
+	core.Schedule.GroupId = "G1"
+	platform.Schedule.GroupId = "G2"
+
+	return &Calendar{
+		Name:      "Wachtdienst",
+		Events:    append(NewCalendarEvents("acme", core), NewCalendarEvents("acme", platform)...),
+		Schedules: []nervecentre.Schedule{core.Schedule, platform.Schedule},
+		Users:     []nervecentre.Member{{UserId: "1", Name: "Alice", Email: "alice@example.com"}, {UserId: "2", Name: "Bob"}},
+	}
+}
+
+func TestCalendar_WriteIcs(t *testing.T) {
+	var ics bytes.Buffer
+
+	if err := newTestCalendar().WriteIcs(&ics, time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("WriteIcs() error = %v", err)
+	}
+
+	assertGolden(t, "calendar.ics", ics.Bytes())
+}
+
+func TestCalendar_Filter(t *testing.T) {
+	tests := []struct {
+		name     string
+		group    string
+		member   string
+		wantName string
+		wantUids []string
+		wantErr  bool
+	}{
+		{
+			name:     "Everything",
+			wantName: "Wachtdienst",
+			wantUids: []string{"acme-G1-20201231T230000Z@nerve-centre-webhook", "acme-G1-20210101T230000Z@nerve-centre-webhook"},
+		},
+		{
+			name:     "Schedule without wachtdiensten",
+			group:    "platform",
+			wantName: "Wachtdienst Platform",
+		},
+		{
+			name:     "Member by email",
+			member:   "ALICE@example.com",
+			wantName: "Wachtdienst Alice",
+			wantUids: []string{"acme-G1-20201231T230000Z@nerve-centre-webhook"},
+		},
+		{
+			name:    "Unknown schedule",
+			group:   "G3",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown member",
+			member:  "Carol",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestCalendar().Filter(tt.group, tt.member)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Filter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var uids []string
+			for _, event := range got.Events {
+				uids = append(uids, event.Uid)
+			}
+			if got.Name != tt.wantName || !Equal(uids, tt.wantUids) {
+				t.Errorf("Filter() = %s %v, want %s %v", got.Name, uids, tt.wantName, tt.wantUids)
+			}
+		})
+	}
+}
+
+func TestVtimezone(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	got := vtimezone(loc, time.Date(2021, 3, 20, 0, 0, 0, 0, loc), time.Date(2021, 11, 1, 0, 0, 0, 0, loc))
+	want := []string{
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Amsterdam",
+		"BEGIN:STANDARD",
+		"DTSTART:20210320T000000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0100",
+		"TZNAME:CET",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20210328T020000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0200",
+		"TZNAME:CEST",
+		"END:DAYLIGHT",
+		"BEGIN:STANDARD",
+		"DTSTART:20211031T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"TZNAME:CET",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+	}
+
+	if !Equal(got, want) {
+		t.Errorf("vtimezone() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 40)
+	got := foldLine(line)
+
+	for _, folded := range strings.Split(got, "\r\n") {
+		if len(folded) > icsMaxLineLength {
+			t.Errorf("foldLine() returned a line of %d octets: %q", len(folded), folded)
+		}
+	}
+
+	if unfolded := strings.ReplaceAll(got, "\r\n ", ""); unfolded != line {
+		t.Errorf("foldLine() unfolds to %q, want %q", unfolded, line)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	if got, want := escapeText("Jansen, Jan; \\ reserve\nDe Vries"), `Jansen\, Jan\; \\ reserve\nDe Vries`; got != want {
+		t.Errorf("escapeText() = %s, want %s", got, want)
+	}
+}
+
+func TestNewCalendarEvents(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	at := func(day int, hour int) time.Time {
+		return time.Date(2021, 1, day, hour, 0, 0, 0, loc)
+	}
+	users := []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}, {UserId: "3", Name: "Carol"}}
+	plannings := []*nervecentre.Planning{
+		{
+			BaseTimeSlots:    []nervecentre.Slot{{Start: at(1, 0), End: at(2, 0), Members: []string{"1"}}},
+			PrimaryTimeSlots: []nervecentre.Slot{{Start: at(1, 18), End: at(2, 0), Members: []string{"3"}}},
+		},
+		{
+			// The planning of a day can return the last slot of the day before again
+			BaseTimeSlots: []nervecentre.Slot{
+				{Start: at(1, 0), End: at(2, 0), Members: []string{"1"}},
+				{Start: at(2, 0), End: at(3, 0), Members: []string{"2"}},
+			},
+		},
+	}
+
+	overview := NewOverview(nervecentre.Schedule{GroupId: "G1", GroupName: "Core"}, users, plannings, at(1, 12))
+
+	var uids []string
+	for _, event := range NewCalendarEvents("acme", overview) {
+		uids = append(uids, event.Uid)
+	}
+
+	// The slot of Alice that the second day returns again is a single event
+	want := []string{
+		"acme-G1-20201231T230000Z@nerve-centre-webhook",
+		"acme-G1-20210101T170000Z@nerve-centre-webhook",
+		"acme-G1-20210101T230000Z@nerve-centre-webhook",
+	}
+
+	if !Equal(uids, want) {
+		t.Errorf("NewCalendarEvents() = %v, want %v", uids, want)
+	}
+}
+
+func TestRunner_Calendar(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"1"},
+		"2021-01-03": {"1"},
+		"2021-01-04": {"2"},
+		"2021-01-06": {"1"},
+	})
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Horizon = 7
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+
+	var previous []string
+
+	// The wachtdienst of Alice that started on the first day keeps its start and Uid on the days after it
+	for day := 1; day <= 3; day++ {
+		calendar, err := runner.Calendar(context.Background(), time.Date(2021, 1, day, 12, 0, 0, 0, loc))
+
+		if err != nil {
+			t.Fatalf("Calendar() on day %d error = %v", day, err)
+		}
+
+		var events []string
+
+		for _, event := range calendar.Events {
+			events = append(events, event.Uid+" "+event.Shift.Start.UTC().Format(time.RFC3339))
+		}
+
+		// The wachtdienst after the day without members is in the calendar as well
+		want := []string{
+			"acme-G1-20201231T230000Z@nerve-centre-webhook 2020-12-31T23:00:00Z",
+			"acme-G1-20210103T230000Z@nerve-centre-webhook 2021-01-03T23:00:00Z",
+			"acme-G1-20210105T230000Z@nerve-centre-webhook 2021-01-05T23:00:00Z",
+		}
+
+		if !Equal(events, want) {
+			t.Errorf("Calendar() on day %d = %v, want %v", day, events, want)
+		}
+
+		if previous != nil && events[0] != previous[0] {
+			t.Errorf("Calendar() on day %d starts with %s, on the day before with %s", day, events[0], previous[0])
+		}
+
+		previous = events
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+)
+
+// MattermostPayload is the payload of a Mattermost incoming webhook. Its attachments look like those of Slack, but
+// Mattermost ignores the timestamp of an attachment and shows Props["card"] as markdown in the sidebar.
+type MattermostPayload struct {
+	Username    string                 `json:"username,omitempty"`
+	Channel     string                 `json:"channel,omitempty"`
+	Text        string                 `json:"text,omitempty"`
+	Attachments []MattermostAttachment `json:"attachments,omitempty"`
+	Props       map[string]string      `json:"props,omitempty"`
+}
+
+type MattermostAttachment struct {
+	Fallback string `json:"fallback,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// MattermostNotifier posts to a Mattermost incoming webhook, to Channel when it is set.
+type MattermostNotifier struct {
+	Webhook string
+	Channel string
+}
+
+// Notify posts the overviews as coloured attachments, with a card listing them as a table.
+func (notifier *MattermostNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	message := OverviewMessage(overviews)
+
+	return notifier.post(ctx, &MattermostPayload{
+		Username:    message.Username(),
+		Text:        message.Text.String(),
+		Attachments: mattermostAttachments(message.Sections),
+		Props:       map[string]string{"card": overviewCard(overviews)},
+	})
+}
+
+func (notifier *MattermostNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	return notifier.post(ctx, &MattermostPayload{
+		Username: "⚠️ Wachtdienst " + schedule.GroupName,
+		Text:     "Kon wachtdiensten niet ophalen uit Nerve Centre: " + message,
+	})
+}
+
+func (notifier *MattermostNotifier) Send(ctx context.Context, message *Message) error {
+	return notifier.post(ctx, &MattermostPayload{
+		Username:    message.Username(),
+		Text:        message.Text.String(),
+		Attachments: mattermostAttachments(message.Sections),
+	})
+}
+
+func (notifier *MattermostNotifier) post(ctx context.Context, message *MattermostPayload) error {
+	if message.Channel == "" {
+		message.Channel = notifier.Channel
+	}
+
+	return postJson(ctx, "mattermost", notifier.Webhook, message)
+}
+
+// mattermostAttachments renders sections as attachments coloured by their severity.
+func mattermostAttachments(sections []Section) []MattermostAttachment {
+	attachments := make([]MattermostAttachment, 0, len(sections))
+
+	for _, section := range sections {
+		attachments = append(attachments, MattermostAttachment{
+			Fallback: section.Title + ": " + section.Text.String(),
+			Color:    severityColors[section.Severity],
+			Title:    section.Title,
+			Text:     section.Text.String(),
+		})
+	}
+
+	return attachments
+}
+
+// overviewCard returns a markdown table with a row for every overview.
+func overviewCard(overviews []*Overview) string {
+	rows := []string{"| Wachtdienst | Vandaag | Volgende | Einde rooster |", "|---|---|---|---|"}
+
+	for _, overview := range overviews {
+		today, _ := overview.today()
+		next := ""
+		rosterEnd := ""
+
+		if overview.Next != nil {
+			nextText, _ := overview.next()
+			next = nextText.String()
+		}
+
+		if overview.HasRoster {
+			rosterEnd = overview.format(overview.RosterEnd, "02-01-2006 15:04")
+		}
+
+		rows = append(rows, "| "+strings.Join([]string{overview.Schedule.GroupName, today.String(), next, rosterEnd}, " | ")+" |")
+	}
+
+	return strings.Join(rows, "\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMattermostNotifier_Notify(t *testing.T) {
+	core, platform := newTestOverviews()
+
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+
+		var message struct {
+			Channel     string
+			Text        string
+			Attachments []map[string]interface{}
+			Props       struct {
+				Card string
+			}
+		}
+
+		if err := json.Unmarshal(body, &message); err != nil || message.Text == "" || message.Props.Card == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, attachment := range message.Attachments {
+			// Mattermost has no timestamps on attachments
+			if _, ok := attachment["ts"]; ok || attachment["color"] == nil || attachment["title"] == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if message.Channel != "town-square" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	notifier := &MattermostNotifier{Webhook: ts.URL, Channel: "town-square"}
+
+	if err := notifier.Notify(context.Background(), []*Overview{core, platform}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "mattermost-combined.json", append(indented.Bytes(), '\n'))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+)
+
+// SlackUsers maps Nerve Centre members to Slack users, from the configured users and optionally by looking up the
+// email address of the member in Slack. Lookups are remembered, also when Slack has no user for the address.
+type SlackUsers struct {
+	users  map[string]string
+	api    *SlackApi
+	lookup map[string]string
+}
+
+func NewSlackUsers(config SlackConfig, api *SlackApi) *SlackUsers {
+	users := make(map[string]string, len(config.Users))
+
+	for key, id := range config.Users {
+		users[strings.ToLower(strings.TrimSpace(key))] = id
+	}
+
+	if !config.LookupByEmail {
+		api = nil
+	}
+
+	return &SlackUsers{
+		users:  users,
+		api:    api,
+		lookup: make(map[string]string),
+	}
+}
+
+// Resolve returns the Slack user id of member, looking it up by user id, name and email in that order. An empty id
+// is returned when the member has no Slack user, together with an error when looking it up failed.
+func (slackUsers *SlackUsers) Resolve(ctx context.Context, member nervecentre.Member) (string, error) {
+	for _, key := range []string{member.UserId, member.Name, member.Email} {
+		if id, ok := slackUsers.users[strings.ToLower(strings.TrimSpace(key))]; ok && key != "" {
+			return id, nil
+		}
+	}
+
+	if slackUsers.api == nil || member.Email == "" {
+		return "", nil
+	}
+
+	if id, ok := slackUsers.lookup[member.Email]; ok {
+		return id, nil
+	}
+
+	id, err := slackUsers.api.LookupUserByEmail(ctx, member.Email)
+
+	if err != nil && !errors.Is(err, ErrSlackUserNotFound) {
+		return "", err
+	}
+
+	slackUsers.lookup[member.Email] = id
+
+	return id, nil
+}
+
+// Mentions returns a mention like <@U123> for the name of every member that has a Slack user. Members that could not
+// be resolved are left out, they are shown by name, the first error is returned so it can be logged.
+func (slackUsers *SlackUsers) Mentions(ctx context.Context, members []nervecentre.Member) (map[string]string, error) {
+	mentions := make(map[string]string)
+
+	var firstErr error
+
+	for _, member := range members {
+		id, err := slackUsers.Resolve(ctx, member)
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if id != "" {
+			mentions[strings.TrimSpace(member.Name)] = "<@" + id + ">"
+		}
+	}
+
+	return mentions, firstErr
+}
+
+// shownMembers returns the users with one of names. Only the members that are shown are resolved, as looking up a
+// user by email address is rate limited by Slack.
+func shownMembers(users []nervecentre.Member, names ...[]string) []nervecentre.Member {
+	shown := make(map[string]bool)
+
+	for _, list := range names {
+		for _, name := range list {
+			shown[name] = true
+		}
+	}
+
+	members := make([]nervecentre.Member, 0, len(shown))
+
+	for _, user := range users {
+		if shown[strings.TrimSpace(user.Name)] {
+			members = append(members, user)
+		}
+	}
+
+	return members
+}
+
+// mention replaces the names that have a mention, the other names are kept as they are.
+func mention(names []string, mentions map[string]string) []string {
+	mentioned := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if value, ok := mentions[name]; ok {
+			name = value
+		}
+
+		mentioned = append(mentioned, name)
+	}
+
+	return mentioned
+}
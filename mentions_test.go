@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSlackUsers_Mentions(t *testing.T) {
+	lookups := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if r.URL.Path != "/users.lookupByEmail" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+			return
+		}
+		switch r.FormValue("email") {
+		case "carol@example.com":
+			w.Write([]byte(`{"ok": true, "user": {"id": "U3"}}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "users_not_found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	api := NewSlackApi("xoxb-test")
+	api.baseUrl = ts.URL
+
+	slackUsers := NewSlackUsers(SlackConfig{
+		Users: map[string]string{
+			"1":          "U1",
+			"Bob Jansen": "U2",
+		},
+		LookupByEmail: true,
+	}, api)
+
+	members := []nervecentre.Member{
+		{UserId: "1", Name: "Alice"},
+		{UserId: "2", Name: " Bob Jansen "},
+		{UserId: "3", Name: "Carol", Email: "carol@example.com"},
+		{UserId: "4", Name: "Dave", Email: "dave@example.com"},
+		{UserId: "5", Name: "Erin"},
+	}
+
+	want := map[string]string{
+		"Alice":      "<@U1>",
+		"Bob Jansen": "<@U2>",
+		"Carol":      "<@U3>",
+	}
+
+	for run := 0; run < 2; run++ {
+		got, err := slackUsers.Mentions(context.Background(), members)
+
+		if err != nil {
+			t.Fatalf("Mentions() error = %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Mentions() = %v, want %v", got, want)
+		}
+	}
+
+	if lookups != 2 {
+		t.Errorf("Mentions() looked up %d email addresses, want 2 looked up once", lookups)
+	}
+
+	if got := mention([]string{"Alice", "Erin"}, want); !reflect.DeepEqual(got, []string{"<@U1>", "Erin"}) {
+		t.Errorf("mention() = %v, want [<@U1> Erin]", got)
+	}
+}
+
+func TestShownMembers(t *testing.T) {
+	users := []nervecentre.Member{
+		{UserId: "1", Name: "Alice"},
+		{UserId: "2", Name: " Bob Jansen "},
+		{UserId: "3", Name: "Carol"},
+	}
+
+	want := []nervecentre.Member{users[0], users[1]}
+
+	if got := shownMembers(users, []string{"Alice"}, []string{"Bob Jansen", "Dave"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("shownMembers() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strings"
+	"time"
+)
+
+// Severity tells how a part of a message is doing, chat services show it as a colour or a style.
+type Severity string
+
+const (
+	SeverityGood      Severity = "good"
+	SeverityWarning   Severity = "warning"
+	SeverityAttention Severity = "attention"
+)
+
+// severityColors are the colours of the severities in services that colour a part of a message.
+var severityColors = map[Severity]string{
+	SeverityGood:      "#007a5a",
+	SeverityWarning:   "#ffc917",
+	SeverityAttention: "#ec0045",
+}
+
+// Message is a message of the runner independent of the chat service it is sent to, every notifier renders it in the
+// way of its service.
+type Message struct {
+	// Icon is shown in front of the sender, like 📞 in "📞 Wachtdienst Core"
+	Icon string
+	// Schedule is empty for a message about several schedules
+	Schedule nervecentre.Schedule
+	// Title says what the message is about in a few words, like "Overdracht"
+	Title    string
+	Text     Text
+	Sections []Section
+}
+
+// Section is a titled part of a message, like an attachment in Slack or a container in Teams.
+type Section struct {
+	Title    string
+	Text     Text
+	Severity Severity
+	// Time is the moment the section is about, it is zero when there is none
+	Time time.Time
+}
+
+// Text is a text in which the names of members are kept apart, so chat services that can mention members do.
+type Text []TextPart
+
+// TextPart is the names of Members joined by commas, or Text when there are no members.
+type TextPart struct {
+	Text    string
+	Members []string
+}
+
+// NewText returns a text without members.
+func NewText(text string) Text {
+	return Text{{Text: text}}
+}
+
+// Username returns the sender of message, the icon followed by the schedule.
+func (message *Message) Username() string {
+	if message.Schedule.GroupName == "" {
+		return message.Icon + " Wachtdienst"
+	}
+
+	return message.Icon + " Wachtdienst " + message.Schedule.GroupName
+}
+
+// Names returns the names of the members in the text and the sections of message.
+func (message *Message) Names() []string {
+	texts := []Text{message.Text}
+
+	for _, section := range message.Sections {
+		texts = append(texts, section.Text)
+	}
+
+	names := make([]string, 0)
+
+	for _, text := range texts {
+		for _, part := range text {
+			names = append(names, part.Members...)
+		}
+	}
+
+	return names
+}
+
+// Render returns text with the mentions of the members that have one, the other members are shown by name.
+func (text Text) Render(mentions map[string]string) string {
+	var rendered strings.Builder
+
+	for _, part := range text {
+		if len(part.Members) > 0 {
+			rendered.WriteString(strings.Join(mention(part.Members, mentions), ", "))
+		} else {
+			rendered.WriteString(part.Text)
+		}
+	}
+
+	return rendered.String()
+}
+
+func (text Text) String() string {
+	return text.Render(nil)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestText_Render(t *testing.T) {
+	text := Text{
+		{Text: "Herinnering: "},
+		{Members: []string{"Alice", "Bob"}},
+		{Text: ", van "},
+		{Members: nil, Text: "<<geen>>"},
+	}
+
+	tests := []struct {
+		name     string
+		mentions map[string]string
+		want     string
+	}{
+		{
+			name: "Without mentions",
+			want: "Herinnering: Alice, Bob, van <<geen>>",
+		},
+		{
+			name:     "With mentions",
+			mentions: map[string]string{"Bob": "<@U2>"},
+			want:     "Herinnering: Alice, <@U2>, van <<geen>>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := text.Render(tt.mentions); got != tt.want {
+				t.Errorf("Render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
 	"flag"
-	"strconv"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"syscall"
 	"time"
@@ -12,153 +19,266 @@ import (
 
 func main() {
 
+	configPath := flag.String("config", "", "YAML or JSON configuration file, flags that are set override it")
 	username := flag.String("username", "", "Nerve Centre username")
 	password := flag.String("password", "", "Nerve Centre password")
 	namespace := flag.String("namespace", "", "Nerve Centre namespace")
 	webhookUrl := flag.String("webhook", "", "Slack webhook url")
 	channel := flag.String("channel", "", "Slack channel override")
-	flag.Parse()
-
-	if *username == "" || *password == "" || *namespace == "" || *webhookUrl == "" {
-		flag.Usage()
-		syscall.Exit(1)
+	group := flag.String("group", "", "Only report on the schedule with this Nerve Centre group id or group name")
+	combine := flag.Bool("combine", false, "Post one combined message for all schedules instead of one message per schedule")
+	verbose := flag.Bool("verbose", false, "Log every request made to Nerve Centre")
+	deadline := flag.Duration("deadline", 0, "Maximum duration of the whole run, or of every job run in serve mode, for example 2m (no deadline by default)")
+	horizon := Days(90)
+	flag.Var(&horizon, "horizon", "How far ahead the roster is checked, for example 90d or 12w")
+	timezone := flag.String("timezone", "", "Timezone of the Nerve Centre planning, also used to display times (default Europe/Amsterdam)")
+	scheduleTimezones := ScheduleTimezones{}
+	flag.Var(&scheduleTimezones, "schedule-timezone", "Timezone for a single schedule as group=timezone, for example Lisbon=Europe/Lisbon (repeatable)")
+	concurrency := flag.Int("concurrency", 4, "Maximum number of days fetched from Nerve Centre at the same time")
+	cron := flag.String("cron", "", "Cron expression to run -task on in serve mode, replacing the configured jobs, for example \"30 8 * * *\"")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long a running job may finish when serve mode is stopped")
+	task := flag.String("task", TaskOverview, "Task to run: "+strings.Join(Tasks, ", "))
+	statePath := flag.String("state", DefaultStatePath, "File that remembers what was seen at the previous run, used by the handover, changes and reminder tasks")
+	reminderLead := Duration(2 * time.Hour)
+	flag.Var(&reminderLead, "reminder-lead", "How long before a wachtdienst starts its members are reminded, for example 2h")
+	reminderAt := flag.String("reminder-at", "", "Remind members at this time on the day before their wachtdienst instead, for example 19:00")
+	slackToken := flag.String("slack-token", "", "Slack bot token, used to look up the Slack users of members")
+	format := flag.String("format", FormatAttachments, "How the overview is rendered in Slack: "+strings.Join(Formats, " or "))
+	output := flag.String("output", "", "File the export is written to (stdout by default)")
+	member := flag.String("member", "", "Only export the wachtdiensten of this member, by user id, name or email address")
+	listen := flag.String("listen", "", "Address to serve the calendar over HTTP on in serve mode, for example :8080")
+	httpToken := flag.String("http-token", "", "Token HTTP requests have to pass as bearer token or in the token query parameter")
+	refresh := Duration(DefaultRefresh)
+	flag.Var(&refresh, "refresh", "How often the HTTP server refreshes the rosters from Nerve Centre, for example 5m")
+	flag.Usage = usage(flag.CommandLine)
+
+	command := "run"
+	exportFormat := ""
+	args := os.Args[1:]
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
 	}
 
-	// Apply namespace
-	nerveCentreBaseUrl = nerveCentreBaseUrl + *namespace
-	usernameWithNamespace := *username + "@" + *namespace
+	if command == "export" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		exportFormat = args[0]
+		args = args[1:]
+	}
 
-	err := Login(usernameWithNamespace, *password)
+	flag.CommandLine.Parse(args)
 
-	if err != nil {
-		sendFailureToSlack(webhookUrl, Schedule{}, channel, err)
+	switch command {
+	case "run", "serve":
+	case "export":
+		if exportFormat != "ics" {
+			exitWithUsage(fmt.Errorf("unknown export format %q, should be ics", exportFormat))
+		}
+	default:
+		exitWithUsage(fmt.Errorf("unknown command %q", command))
 	}
 
-	users := GetMembers()
-	schedules := *GetSchedules()
+	if err := ApplyEnvironment(flag.CommandLine); err != nil {
+		exitWithUsage(err)
+	}
 
-	if len(*users) == 0 || len(schedules) == 0 {
-		sendFailureToSlack(webhookUrl, Schedule{}, channel, errors.New("could not load users or schedules, check username and password"))
+	// The task can also be set by the environment
+	if !IsTask(*task) {
+		exitWithUsage(fmt.Errorf("unknown task %q", *task))
 	}
 
-	schedule := schedules[0]
+	config := NewConfig()
 
-	runTime := time.Now()
-	planningTime := time.Now()
-	planningEnd := time.Now()
-	planning, err := GetPlanning(schedule, runTime)
+	if *configPath != "" {
+		loaded, err := LoadConfig(*configPath)
 
-	if err != nil {
-		sendFailureToSlack(webhookUrl, schedule, channel, err)
-	}
+		if err != nil {
+			exitWithUsage(err)
+		}
 
-	today := planning.GetActiveSlot(runTime)
-	var next *Slot
+		config = loaded
+	}
 
-	var currentPlanningEnd time.Time
-	var currentMembers []string
+	overrides := Overrides{}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "namespace":
+			overrides.Namespace = namespace
+		case "username":
+			overrides.Username = username
+		case "password":
+			overrides.Password = password
+		case "webhook":
+			overrides.Webhook = webhookUrl
+		case "channel":
+			overrides.Channel = channel
+		case "timezone":
+			overrides.Timezone = timezone
+		case "horizon":
+			overrides.Horizon = &horizon
+		case "concurrency":
+			overrides.Concurrency = concurrency
+		case "combine":
+			overrides.Combine = combine
+		case "cron":
+			overrides.Cron = cron
+		case "task":
+			overrides.Task = task
+		case "state":
+			overrides.State = statePath
+		case "reminder-lead":
+			overrides.ReminderLead = &reminderLead
+		case "reminder-at":
+			overrides.ReminderAt = reminderAt
+		case "slack-token":
+			overrides.SlackToken = slackToken
+		case "format":
+			overrides.Format = format
+		case "listen":
+			overrides.Listen = listen
+		case "http-token":
+			overrides.HttpToken = httpToken
+		case "refresh":
+			overrides.Refresh = &refresh
+		}
+	})
 
-	if planning.HasMembers() {
-		slot := planning.GetActiveSlot(runTime)
-		currentPlanningEnd = slot.End
-		currentMembers = slot.GetMembers(users)
+	if err := config.Override(overrides); err != nil {
+		exitWithUsage(err)
 	}
 
-	foundOther := false
+	validate := config.Validate
 
-	for planning.HasMembers() {
+	// Exports and a server without jobs only read from Nerve Centre
+	if command == "export" || command == "serve" && len(config.Jobs) == 0 {
+		validate = config.ValidateWithoutDestinations
+	}
 
-		for _, slot := range planning.BaseTimeSlots {
+	if err := validate(); err != nil {
+		exitWithUsage(err)
+	}
 
-			// Filter current active slot and older slots
-			if runTime.After(slot.Start) || runTime.Equal(slot.Start) {
-				continue
-			}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			planningEnd = slot.End
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	runner := NewRunner(config, *group, scheduleTimezones, logger, *verbose)
 
-			if !foundOther {
-				members := slot.GetMembers(users)
+	if command == "serve" {
+		serve(ctx, config, runner, logger, *deadline, *shutdownTimeout)
+		return
+	}
 
-				if !Equal(currentMembers, members) {
-					foundOther = true
-					next = &slot
-				} else {
-					currentPlanningEnd = slot.End
-				}
-			}
-		}
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
 
-		planningTime = planningTime.Add(24 * time.Hour)
-		planning, err = GetPlanning(schedule, planningTime)
-		if err != nil {
-			sendFailureToSlack(webhookUrl, schedule, channel, err)
+	if command == "export" {
+		if err := export(ctx, runner, *member, *output); err != nil {
+			runner.logf("Could not export: %v", err)
+			stop()
+			syscall.Exit(1)
 		}
+
+		return
 	}
 
-	todayMembersString := "<<geen>>"
-	todayColor := "#ec0045"
-	if len(currentMembers) > 0 {
-		todayMembersString = strings.Join(currentMembers, ", ") + " tot " + currentPlanningEnd.Format("02-01-2006 15:04")
-		todayColor = "#007a5a"
+	runner.Run(ctx, *task, time.Now())
+
+	if runner.Failed() {
+		stop()
+		syscall.Exit(1)
 	}
+}
 
-	attachments := make([]Attachment, 0, 3)
+func serve(ctx context.Context, config *Config, runner *Runner, logger *log.Logger, deadline time.Duration, shutdownTimeout time.Duration) {
+	if len(config.Jobs) == 0 && config.Http.Listen == "" {
+		exitWithUsage(fmt.Errorf("serve needs at least one job or an HTTP address, configure jobs, set -cron or set -listen"))
+	}
 
-	attachments = append(attachments, Attachment{
-		Fallback: "Vandaag: " + todayMembersString,
-		Color:    todayColor,
-		Title:    "Vandaag",
-		Text:     todayMembersString,
-	})
+	jobs, err := NewJobs(config.Jobs)
 
-	if foundOther && next != nil {
-		nextMembers := next.GetMembers(users)
-		nextMembersString := "<<geen>>"
-		nextColor := "#ec0045"
+	if err != nil {
+		exitWithUsage(err)
+	}
+
+	location, err := config.Location(TenantConfig{}, ScheduleConfig{})
+
+	if err != nil {
+		exitWithUsage(err)
+	}
+
+	if config.Http.Listen != "" {
+		listener, err := net.Listen("tcp", config.Http.Listen)
 
-		if len(currentMembers) > 0 {
-			nextMembersString = strings.Join(nextMembers, ", ") + " op " + next.Start.Format("02-01-2006 om 15:04")
-			nextColor = "#ffc917"
+		if err != nil {
+			exitWithUsage(err)
 		}
 
-		attachments = append(attachments, Attachment{
-			Fallback: "Volgende: " + nextMembersString,
-			Color:    nextColor,
-			Title:    "Volgende",
-			Text:     nextMembersString,
-			Ts:       json.Number(strconv.FormatInt(next.Start.Unix(), 10)),
-		})
+		cache := NewRosterCache(runner, time.Duration(config.Http.Refresh))
+		httpServer := &http.Server{Handler: NewHttpServer(cache, config.Http)}
+		logger.Printf("Serving HTTP on %s", listener.Addr())
+
+		go cache.Run(ctx)
+
+		go func() {
+			if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Printf("HTTP server stopped: %v", err)
+			}
+		}()
+
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			httpServer.Shutdown(shutdownCtx)
+		}()
 	}
 
-	if len(today.GetMembers(users)) > 0 {
-		attachments = append(attachments, Attachment{
-			Fallback: "Er is een rooster tot " + planningEnd.Format("02-01-2006 15:04"),
-			Color:    "#ec0045",
-			Title:    "Einde rooster",
-			Text:     "Er is een rooster tot " + planningEnd.Format("02-01-2006 15:04"),
-			Ts:       json.Number(strconv.FormatInt(planningEnd.Unix(), 10)),
-		})
+	if len(jobs) > 0 {
+		NewServer(runner, jobs, location, logger, deadline, shutdownTimeout).Serve(ctx)
 	}
 
-	message := SlackPayload{
-		Username:    "📞 Wachtdienst " + schedule.GroupName,
-		Channel:     *channel,
-		Text:        "Een overzicht van de de huidige wachtdiensten die zijn ingeregeld voor " + schedule.GroupName + " in Nerve Centre",
-		Attachments: attachments,
+	// The HTTP server keeps serving when no job will run anymore
+	if config.Http.Listen != "" {
+		<-ctx.Done()
 	}
+}
+
+// export writes the wachtdiensten of every schedule, or of member when it is set, as iCalendar to the file output, or
+// to stdout when output is empty.
+func export(ctx context.Context, runner *Runner, member string, output string) error {
+	now := time.Now()
+	calendar, err := runner.Calendar(ctx, now)
 
-	err = SendSlack(*webhookUrl, &message)
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	calendar, err = calendar.Filter("", member)
+
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return calendar.WriteIcs(os.Stdout, now)
+	}
+
+	var ics bytes.Buffer
+
+	if err := calendar.WriteIcs(&ics, now); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, ics.Bytes(), 0644)
 }
 
-func sendFailureToSlack(webhookUrl *string, schedule Schedule, channel *string, err error) {
-	SendSlack(*webhookUrl, &SlackPayload{
-		Username: "⚠️ Wachtdienst " + schedule.GroupName,
-		Channel:  *channel,
-		Text:     "Kon wachtdiensten niet ophalen uit Nerve Centre: " + err.Error(),
-	})
-	panic(err)
+func exitWithUsage(err error) {
+	fmt.Fprintln(flag.CommandLine.Output(), err)
+	flag.Usage()
+	syscall.Exit(1)
 }
@@ -0,0 +1,564 @@
+// Package nervecentre is a client for the reachability schedules of the Nerve Centre portal.
+package nervecentre
+
+import (
+	"4d63.com/tz"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBaseUrl = "https://portal.ncaas.nl/"
+
+const DefaultTimezone = "Europe/Amsterdam"
+
+type Group struct {
+	Members []Member
+}
+
+type Member struct {
+	UserId string
+	Name   string
+	// Email is empty when Nerve Centre has no email address for the user
+	Email string
+}
+
+type Schedule struct {
+	GroupId     string
+	ParameterId string
+	GroupName   string
+}
+
+// Client talks to a single Nerve Centre namespace. A Client keeps the session cookies of Login, so the same
+// Client has to be used for all calls after logging in. When the session expires the Client logs in again with the
+// credentials of the last successful Login and retries the call once.
+type Client struct {
+	baseUrl    string
+	namespace  string
+	httpClient *http.Client
+	location   *time.Location
+	locations  map[string]*time.Location
+	logger     *log.Logger
+
+	mutex    sync.Mutex
+	username string
+	password string
+	// session is incremented on every login, so concurrent calls that find the same expired session log in only once
+	session int
+}
+
+type Option func(client *Client)
+
+// WithBaseUrl overrides the portal url, DefaultBaseUrl is used otherwise.
+func WithBaseUrl(baseUrl string) Option {
+	return func(client *Client) {
+		client.baseUrl = baseUrl
+	}
+}
+
+func WithNamespace(namespace string) Option {
+	return func(client *Client) {
+		client.namespace = namespace
+	}
+}
+
+// WithHttpClient uses a copy of httpClient for all requests. Redirects are never followed, because the login flow
+// depends on them, and a cookie jar is added when the client has none.
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		copied := *httpClient
+		client.httpClient = &copied
+	}
+}
+
+// WithTimezone sets the location Nerve Centre planning times are interpreted in, DefaultTimezone is used otherwise.
+func WithTimezone(location *time.Location) Option {
+	return func(client *Client) {
+		client.location = location
+	}
+}
+
+// WithScheduleTimezone overrides the timezone for the schedule with the given group id or group name.
+func WithScheduleTimezone(group string, location *time.Location) Option {
+	return func(client *Client) {
+		client.locations[strings.ToLower(group)] = location
+	}
+}
+
+func WithLogger(logger *log.Logger) Option {
+	return func(client *Client) {
+		client.logger = logger
+	}
+}
+
+func NewClient(options ...Option) *Client {
+	client := &Client{
+		baseUrl: DefaultBaseUrl,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			Timeout: 60 * time.Second,
+		},
+		locations: make(map[string]*time.Location),
+		logger:    log.New(ioutil.Discard, "", 0),
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	if client.httpClient.Jar == nil {
+		jar, _ := cookiejar.New(nil)
+		client.httpClient.Jar = jar
+	}
+
+	client.httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	if client.location == nil {
+		location, err := tz.LoadLocation(DefaultTimezone)
+
+		if err != nil {
+			client.logger.Printf("Could not load %s, falling back to UTC: %v", DefaultTimezone, err)
+			location = time.UTC
+		}
+
+		client.location = location
+	}
+
+	return client
+}
+
+// Location returns the timezone the planning of schedule is interpreted in.
+func (client *Client) Location(schedule Schedule) *time.Location {
+	if location, ok := client.locations[strings.ToLower(schedule.GroupId)]; ok {
+		return location
+	}
+
+	if location, ok := client.locations[strings.ToLower(schedule.GroupName)]; ok {
+		return location
+	}
+
+	return client.location
+}
+
+func (client *Client) endpoint(path string) string {
+	endpoint := strings.TrimSuffix(client.baseUrl, "/")
+
+	if client.namespace != "" {
+		endpoint += "/" + client.namespace
+	}
+
+	return endpoint + path
+}
+
+func (client *Client) endpointPath(path string) string {
+	endpoint, err := url.Parse(client.endpoint(path))
+
+	if err != nil {
+		return path
+	}
+
+	return endpoint.Path
+}
+
+func (client *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := client.httpClient.Do(req)
+
+	if err != nil {
+		client.logger.Printf("%s %s failed: %v", req.Method, req.URL, err)
+		return nil, &NetworkError{Endpoint: req.URL.Path, Err: err}
+	}
+
+	client.logger.Printf("%s %s returned %d", req.Method, req.URL, resp.StatusCode)
+
+	return resp, nil
+}
+
+func (client *Client) getJson(ctx context.Context, path string, target interface{}) error {
+	session := client.currentSession()
+
+	err := client.getJsonOnce(ctx, path, target)
+
+	var authenticationError *AuthenticationError
+
+	if !errors.As(err, &authenticationError) {
+		return err
+	}
+
+	if reloginErr := client.relogin(ctx, session); reloginErr != nil {
+		return err
+	}
+
+	return client.getJsonOnce(ctx, path, target)
+}
+
+func (client *Client) getJsonOnce(ctx context.Context, path string, target interface{}) error {
+	req, _ := http.NewRequestWithContext(ctx, "GET", client.endpoint(path), nil)
+	req.Header.Set("Accept", "application/json, text/plain, */*")
+
+	resp, err := client.do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return &NetworkError{Endpoint: req.URL.Path, Err: err}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusFound:
+		// Nerve Centre redirects to the login page when the session is missing or expired
+		return &AuthenticationError{Endpoint: req.URL.Path, Status: resp.StatusCode}
+	default:
+		return &StatusError{Endpoint: req.URL.Path, Status: resp.StatusCode}
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return &DecodeError{Endpoint: req.URL.Path, Status: resp.StatusCode, Err: err}
+	}
+
+	return nil
+}
+
+func (client *Client) postForm(ctx context.Context, path string, form url.Values) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(ctx, "POST", client.endpoint(path), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, &AuthenticationError{Endpoint: req.URL.Path, Status: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+// Login starts a session for username, which is qualified with the namespace of the client when it has no namespace
+// of its own.
+func (client *Client) Login(username string, password string) error {
+	return client.LoginContext(context.Background(), username, password)
+}
+
+func (client *Client) LoginContext(ctx context.Context, username string, password string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.login(ctx, username, password); err != nil {
+		return err
+	}
+
+	client.username = username
+	client.password = password
+	client.session++
+
+	return nil
+}
+
+func (client *Client) currentSession() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.session
+}
+
+// relogin logs in again with the credentials of the last successful Login, unless another call already did so after
+// session was started.
+func (client *Client) relogin(ctx context.Context, session int) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.session != session {
+		return nil
+	}
+
+	if client.username == "" {
+		return &AuthenticationError{Endpoint: "/vui/controller/1.0/login", Reason: "session expired before logging in"}
+	}
+
+	client.logger.Printf("Session of %s expired, logging in again", client.username)
+
+	if err := client.login(ctx, client.username, client.password); err != nil {
+		return err
+	}
+
+	client.session++
+
+	return nil
+}
+
+func (client *Client) login(ctx context.Context, username string, password string) error {
+	if len(username) == 0 || len(password) == 0 {
+		return &AuthenticationError{Endpoint: "/vui/controller/1.0/login", Reason: "username or password is not provided"}
+	}
+
+	if client.namespace != "" && !strings.Contains(username, "@") {
+		username = username + "@" + client.namespace
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", client.endpoint("/login.cshtml"), nil)
+
+	resp, err := client.do(req)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	form := url.Values{}
+	form.Add("username", username)
+	form.Add("redirectUri", client.endpoint("/login.cshtml?ReturnUrl=~%2f"))
+	form.Add("promptBehavior", "Auto")
+
+	resp, err = client.postForm(ctx, "/vui/controller/1.0/login", form)
+
+	if err != nil {
+		return err
+	}
+
+	locationHeader := resp.Header.Get("Location")
+
+	stateIndex := strings.LastIndex(locationHeader, "&State=")
+
+	if stateIndex < 0 {
+		return &AuthenticationError{Endpoint: "/vui/controller/1.0/login", Reason: "no state in redirect"}
+	}
+
+	state, _ := url.QueryUnescape(locationHeader[stateIndex+7:])
+
+	form = url.Values{}
+	form.Add("password", password)
+	form.Add("redirectUri", locationHeader)
+	form.Add("promptBehavior", "Auto")
+	form.Add("state", state)
+
+	resp, err = client.postForm(ctx, "/vui/controller/1.0/login/credentials", form)
+
+	if err != nil {
+		return err
+	}
+
+	locationHeader = resp.Header.Get("Location")
+
+	req, err = http.NewRequestWithContext(ctx, "GET", locationHeader, nil)
+
+	if err != nil {
+		return &AuthenticationError{Endpoint: "/vui/controller/1.0/login/credentials", Reason: "invalid redirect"}
+	}
+
+	resp, err = client.do(req)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return &AuthenticationError{Endpoint: req.URL.Path, Status: resp.StatusCode}
+	}
+
+	return nil
+}
+
+func (client *Client) GetMembers(schedule Schedule) ([]Member, error) {
+	return client.GetMembersContext(context.Background(), schedule)
+}
+
+func (client *Client) GetMembersContext(ctx context.Context, schedule Schedule) ([]Member, error) {
+	path := "/um/controller/1.0/groups/" + schedule.GroupId
+
+	var group struct {
+		Members *[]Member
+	}
+
+	if err := client.getJson(ctx, path, &group); err != nil {
+		return nil, err
+	}
+
+	if group.Members == nil {
+		return nil, &DecodeError{Endpoint: client.endpointPath(path), Status: http.StatusOK, Err: fmt.Errorf("group has no members field")}
+	}
+
+	return *group.Members, nil
+}
+
+func (client *Client) GetSchedules() ([]Schedule, error) {
+	return client.GetSchedulesContext(context.Background())
+}
+
+func (client *Client) GetSchedulesContext(ctx context.Context) ([]Schedule, error) {
+	path := "/reachability/controller/1.0/groups/config/schedules"
+
+	var schedules []Schedule
+
+	if err := client.getJson(ctx, path, &schedules); err != nil {
+		return nil, err
+	}
+
+	for i, schedule := range schedules {
+		if schedule.GroupId == "" || schedule.ParameterId == "" {
+			return nil, &DecodeError{Endpoint: client.endpointPath(path), Status: http.StatusOK, Err: fmt.Errorf("schedule %d has no groupId or parameterId", i)}
+		}
+	}
+
+	return schedules, nil
+}
+
+func (client *Client) GetPlanning(schedule Schedule, date time.Time) (*Planning, error) {
+	return client.GetPlanningContext(context.Background(), schedule, date)
+}
+
+func (client *Client) GetPlanningContext(ctx context.Context, schedule Schedule, date time.Time) (*Planning, error) {
+	location := client.Location(schedule)
+	// The day is the day in the timezone of the schedule, not the day wherever this runs
+	dateString := date.In(location).Format("2006-01-02")
+	path := "/reachability/controller/1.0/groups/" + schedule.GroupId + "/config/" + schedule.ParameterId + "/schedule/" + dateString
+
+	var planning struct {
+		Planning
+		BaseTimeSlots *[]Slot
+	}
+
+	if err := client.getJson(ctx, path, &planning); err != nil {
+		return nil, err
+	}
+
+	if planning.BaseTimeSlots == nil {
+		return nil, &DecodeError{Endpoint: client.endpointPath(path), Status: http.StatusOK, Err: fmt.Errorf("planning for %s has no baseTimeSlots field", dateString)}
+	}
+
+	planning.Planning.BaseTimeSlots = *planning.BaseTimeSlots
+
+	fixTimeZoneForPlanning(&planning.Planning, location)
+
+	return &planning.Planning, nil
+}
+
+// GetPlannings fetches the planning of at most days consecutive days starting at from, with at most workers requests
+// in flight. The plannings are returned in order of their day and the result stops before the first day without
+// members, so fewer than days plannings means the end of the roster was found.
+func (client *Client) GetPlannings(ctx context.Context, schedule Schedule, from time.Time, days int, workers int) ([]*Planning, error) {
+	return client.getPlannings(ctx, schedule, from, days, workers, true)
+}
+
+// GetPlanningDays fetches the planning of days consecutive days starting at from like GetPlannings, but does not stop
+// at days without members, so a day on which nobody is on call does not hide the days after it.
+func (client *Client) GetPlanningDays(ctx context.Context, schedule Schedule, from time.Time, days int, workers int) ([]*Planning, error) {
+	return client.getPlannings(ctx, schedule, from, days, workers, false)
+}
+
+func (client *Client) getPlannings(ctx context.Context, schedule Schedule, from time.Time, days int, workers int, stopAtEmptyDay bool) ([]*Planning, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Days are added in the timezone of the schedule, so days on which DST starts or ends are neither skipped nor
+	// fetched twice
+	from = from.In(client.Location(schedule))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		day      int
+		planning *Planning
+		err      error
+	}
+
+	jobs := make(chan int)
+	// Buffered for every day, so workers never block on results that are no longer read
+	results := make(chan result, days)
+
+	go func() {
+		defer close(jobs)
+
+		for day := 0; day < days; day++ {
+			select {
+			case jobs <- day:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for day := range jobs {
+				planning, err := client.GetPlanningContext(ctx, schedule, from.AddDate(0, 0, day))
+				results <- result{day: day, planning: planning, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	plannings := make([]*Planning, 0, days)
+	pending := make(map[int]result)
+
+	for r := range results {
+		pending[r.day] = r
+
+		// Results arrive in any order, so only the days following the last handled day can be handled
+		for {
+			next, ok := pending[len(plannings)]
+
+			if !ok {
+				break
+			}
+
+			delete(pending, next.day)
+
+			if next.err != nil {
+				return nil, next.err
+			}
+
+			if stopAtEmptyDay && !next.planning.HasMembers() {
+				return plannings, nil
+			}
+
+			plannings = append(plannings, next.planning)
+		}
+	}
+
+	// Days are only left unhandled when the producer stopped because the context was done
+	if len(plannings) < days {
+		return nil, ctx.Err()
+	}
+
+	return plannings, nil
+}
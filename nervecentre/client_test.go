@@ -0,0 +1,604 @@
+package nervecentre
+
+import (
+	"4d63.com/tz"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetPlanning(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	type args struct {
+		schedule Schedule
+		date     time.Time
+	}
+	tests := []struct {
+		name    string
+		status  int
+		json    string
+		args    args
+		wantErr bool
+		want    *Planning
+	}{
+		{
+			name: "Planning for Schedule",
+			args: args{
+				schedule: Schedule{
+					GroupName:   "GroupName",
+					ParameterId: "P1",
+					GroupId:     "G1",
+				},
+				date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			status: http.StatusOK,
+			json: `
+			{
+			  "enableManualPlanning": false,
+			  "enablePrimarySchedule": true,
+			  "predefinedTimeSlots": [
+				{
+				  "start": "2021-05-31T00:00:00Z",
+				  "end": "2021-06-01T00:00:00Z",
+				  "minMembers": 1,
+				  "maxMembers": 2
+				}
+			  ],
+			  "baseTimeSlots": [
+				{
+				  "members": [
+					"a9f656bf-85af-415b-807c-81728f255f03"
+				  ],
+				  "start": "2021-05-31T00:00:00Z",
+				  "end": "2021-06-01T00:00:00Z",
+				  "minMembers": 1,
+				  "maxMembers": 2
+				}
+			  ],
+			  "primaryTimeSlots": []
+			}
+`,
+			wantErr: false,
+			want: &Planning{
+				PrimaryTimeSlots: []Slot{},
+				BaseTimeSlots: []Slot{
+					{
+						Start: time.Date(2021, 5, 31, 0, 0, 0, 0, loc),
+						End:   time.Date(2021, 6, 1, 0, 0, 0, 0, loc),
+						Members: []string{
+							"a9f656bf-85af-415b-807c-81728f255f03",
+						},
+						MinMembers: 1,
+						MaxMembers: 2,
+					},
+				},
+				PredefinedTimeSlots: []Slot{
+					{
+						Start:      time.Date(2021, 5, 31, 0, 0, 0, 0, loc),
+						End:        time.Date(2021, 6, 1, 0, 0, 0, 0, loc),
+						MinMembers: 1,
+						MaxMembers: 2,
+					},
+				},
+			},
+		},
+		{
+			name: "Planning for Schedule returns error",
+			args: args{
+				schedule: Schedule{
+					GroupName:   "GroupName",
+					ParameterId: "P1",
+					GroupId:     "G1",
+				},
+				date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			status:  http.StatusInternalServerError,
+			json:    "",
+			wantErr: true,
+			want:    nil,
+		},
+		{
+			name: "Planning with changed shape returns error",
+			args: args{
+				schedule: Schedule{
+					GroupName:   "GroupName",
+					ParameterId: "P1",
+					GroupId:     "G1",
+				},
+				date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			status:  http.StatusOK,
+			json:    `{"slots": []}`,
+			wantErr: true,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.json))
+			}))
+			defer ts.Close()
+			client := NewClient(WithBaseUrl(ts.URL))
+
+			got, err := client.GetPlanning(tt.args.schedule, tt.args.date)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPlanning() = %v, want %v", got, tt.want)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetPlanning() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetPlanningContext_Cancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	client := NewClient(WithBaseUrl(ts.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	got, err := client.GetPlanningContext(ctx, Schedule{GroupId: "G1", ParameterId: "P1"}, time.Now())
+
+	if got != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetPlanningContext() = %v, error = %v, want %v", got, err, context.DeadlineExceeded)
+	}
+}
+
+func TestGetPlannings(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	tests := []struct {
+		name      string
+		days      int
+		emptyFrom int
+		failOn    int
+		// everyDay fetches with GetPlanningDays, which does not stop at the end of the roster
+		everyDay bool
+		wantDays int
+		wantErr  bool
+	}{
+		{
+			name:      "End of roster within horizon",
+			days:      30,
+			emptyFrom: 10,
+			failOn:    -1,
+			wantDays:  10,
+		},
+		{
+			name:      "Horizon reached",
+			days:      5,
+			emptyFrom: 10,
+			failOn:    -1,
+			wantDays:  5,
+		},
+		{
+			name:      "Failure before end of roster",
+			days:      30,
+			emptyFrom: 10,
+			failOn:    3,
+			wantErr:   true,
+		},
+		{
+			name:      "Failure after end of roster",
+			days:      30,
+			emptyFrom: 10,
+			failOn:    12,
+			wantDays:  10,
+		},
+		{
+			name:      "Every day after end of roster",
+			days:      30,
+			emptyFrom: 10,
+			failOn:    -1,
+			everyDay:  true,
+			wantDays:  30,
+		},
+		{
+			name:      "Every day with failure after end of roster",
+			days:      30,
+			emptyFrom: 10,
+			failOn:    12,
+			everyDay:  true,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				date, _ := time.Parse("2006-01-02", path.Base(r.URL.Path))
+				day := int(date.Sub(from).Hours() / 24)
+				if day == tt.failOn {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				members := []string{"1"}
+				if day >= tt.emptyFrom {
+					members = []string{}
+				}
+				body, _ := json.Marshal(Planning{BaseTimeSlots: []Slot{{Start: date, End: date.Add(24 * time.Hour), Members: members}}})
+				w.WriteHeader(http.StatusOK)
+				w.Write(body)
+			}))
+			defer ts.Close()
+			client := NewClient(WithBaseUrl(ts.URL))
+
+			getPlannings := client.GetPlannings
+			if tt.everyDay {
+				getPlannings = client.GetPlanningDays
+			}
+
+			got, err := getPlannings(context.Background(), Schedule{GroupId: "G1", ParameterId: "P1"}, from, tt.days, 4)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPlannings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != tt.wantDays {
+				t.Fatalf("GetPlannings() returned %d days, want %d", len(got), tt.wantDays)
+			}
+
+			for day, planning := range got {
+				if want := time.Date(2021, 1, 1+day, 0, 0, 0, 0, loc); !planning.BaseTimeSlots[0].Start.Equal(want) {
+					t.Errorf("GetPlannings() day %d starts at %v, want %v", day, planning.BaseTimeSlots[0].Start, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPlannings_Timezone(t *testing.T) {
+	lisbon, _ := tz.LoadLocation("Europe/Lisbon")
+	tests := []struct {
+		name     string
+		options  []Option
+		schedule Schedule
+		from     time.Time
+		want     []string
+	}{
+		{
+			name:     "Days in Amsterdam around DST start",
+			options:  []Option{},
+			schedule: Schedule{GroupId: "G1", ParameterId: "P1", GroupName: "Core"},
+			from:     time.Date(2021, 3, 26, 23, 30, 0, 0, time.UTC),
+			want:     []string{"2021-03-27", "2021-03-28", "2021-03-29"},
+		},
+		{
+			name:     "Days in Lisbon by group name",
+			options:  []Option{WithScheduleTimezone("core", lisbon)},
+			schedule: Schedule{GroupId: "G1", ParameterId: "P1", GroupName: "Core"},
+			from:     time.Date(2021, 3, 26, 23, 30, 0, 0, time.UTC),
+			want:     []string{"2021-03-26", "2021-03-27", "2021-03-28"},
+		},
+		{
+			name:     "Days in Amsterdam around DST end",
+			options:  []Option{WithScheduleTimezone("G2", lisbon)},
+			schedule: Schedule{GroupId: "G1", ParameterId: "P1", GroupName: "Core"},
+			from:     time.Date(2021, 10, 30, 22, 30, 0, 0, time.UTC),
+			want:     []string{"2021-10-31", "2021-11-01", "2021-11-02"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			requested := make([]string, 0, len(tt.want))
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				date := path.Base(r.URL.Path)
+				mutex.Lock()
+				requested = append(requested, date)
+				mutex.Unlock()
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"baseTimeSlots": [{"start": "` + date + `T00:00:00Z", "end": "` + date + `T23:59:59Z", "members": ["1"]}]}`))
+			}))
+			defer ts.Close()
+			client := NewClient(append(tt.options, WithBaseUrl(ts.URL))...)
+
+			_, err := client.GetPlannings(context.Background(), tt.schedule, tt.from, len(tt.want), 1)
+
+			if err != nil {
+				t.Fatalf("GetPlannings() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(requested, tt.want) {
+				t.Errorf("GetPlannings() requested %v, want %v", requested, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSchedules(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		json    string
+		want    []Schedule
+		wantErr interface{}
+	}{
+		{
+			name:   "Single Schedule",
+			status: http.StatusOK,
+			json:   `[{"groupId": "G1", "parameterId": "P1", "groupName": "GroupName"}]`,
+			want: []Schedule{
+				{
+					GroupName:   "GroupName",
+					ParameterId: "P1",
+					GroupId:     "G1",
+				},
+			},
+		},
+		{
+			name:    "Session expired",
+			status:  http.StatusFound,
+			wantErr: &AuthenticationError{},
+		},
+		{
+			name:    "Server error",
+			status:  http.StatusInternalServerError,
+			wantErr: &StatusError{},
+		},
+		{
+			name:    "Changed shape",
+			status:  http.StatusOK,
+			json:    `{"schedules": []}`,
+			wantErr: &DecodeError{},
+		},
+		{
+			name:    "Schedule without group",
+			status:  http.StatusOK,
+			json:    `[{"id": "G1"}]`,
+			wantErr: &DecodeError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.json))
+			}))
+			defer ts.Close()
+			client := NewClient(WithBaseUrl(ts.URL))
+			got, err := client.GetSchedules()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetSchedules() = %v, want %v", got, tt.want)
+			}
+			if !isErrorOfType(err, tt.wantErr) {
+				t.Errorf("GetSchedules() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		json    string
+		want    []Member
+		wantErr interface{}
+	}{
+		{
+			name:   "Single Member",
+			status: http.StatusOK,
+			json:   `{"members": [{"userId": "1", "name": "alice"}]}`,
+			want: []Member{
+				{
+					UserId: "1",
+					Name:   "alice",
+				},
+			},
+		},
+		{
+			name:   "Two Users",
+			status: http.StatusOK,
+			json:   `{"members": [{"userId": "1", "name": "alice"}, {"userId": "2", "name": "bob"}]}`,
+			want: []Member{
+				{
+					UserId: "1",
+					Name:   "alice",
+				},
+				{
+					UserId: "2",
+					Name:   "bob",
+				},
+			},
+		},
+		{
+			name:    "Unknown group",
+			status:  http.StatusNotFound,
+			wantErr: &StatusError{},
+		},
+		{
+			name:    "Changed shape",
+			status:  http.StatusOK,
+			json:    `{"users": [{"userId": "1", "name": "alice"}]}`,
+			wantErr: &DecodeError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/um/controller/1.0/groups/G1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.json))
+			}))
+			defer ts.Close()
+			client := NewClient(WithBaseUrl(ts.URL))
+			got, err := client.GetMembers(Schedule{GroupId: "G1"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMembers() = %v, want %v", got, tt.want)
+			}
+			if !isErrorOfType(err, tt.wantErr) {
+				t.Errorf("GetMembers() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetMembers_NetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	client := NewClient(WithBaseUrl(ts.URL))
+
+	_, err := client.GetMembers(Schedule{GroupId: "G1"})
+
+	var networkError *NetworkError
+	if !errors.As(err, &networkError) || networkError.Endpoint != "/um/controller/1.0/groups/G1" {
+		t.Errorf("GetMembers() error = %v, want NetworkError for /um/controller/1.0/groups/G1", err)
+	}
+}
+
+func TestGetMembers_Relogin(t *testing.T) {
+	logins := 0
+	expired := true
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/um/controller/1.0/groups/G1":
+			if expired {
+				w.Header().Set("Location", ts.URL+"/login.cshtml")
+				w.WriteHeader(http.StatusFound)
+				return
+			}
+			w.Write([]byte(`{"members": [{"userId": "1", "name": "alice"}]}`))
+		case "/vui/controller/1.0/login/credentials":
+			logins++
+			expired = false
+			w.Header().Set("Location", ts.URL+"/login.cshtml?ReturnUrl=~%2f")
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.Header().Set("Location", ts.URL+"?ReturnUrl=~%2f&State=1234567890")
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+	client := NewClient(WithBaseUrl(ts.URL))
+
+	if _, err := client.GetMembers(Schedule{GroupId: "G1"}); !isErrorOfType(err, &AuthenticationError{}) {
+		t.Fatalf("GetMembers() before Login() error = %v, want AuthenticationError", err)
+	}
+
+	if err := client.Login("bob", "alice"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	expired = true
+
+	got, err := client.GetMembers(Schedule{GroupId: "G1"})
+
+	if err != nil {
+		t.Fatalf("GetMembers() after expired session error = %v", err)
+	}
+
+	if len(got) != 1 || logins != 2 {
+		t.Errorf("GetMembers() = %v after %d logins, want 1 member after 2 logins", got, logins)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	type args struct {
+		username string
+		password string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Success",
+			args: args{
+				username: "bob",
+				password: "alice",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Failure",
+			args: args{
+				username: "bob",
+				password: "alice",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ts *httptest.Server
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.wantErr {
+					w.WriteHeader(http.StatusForbidden)
+				} else {
+					w.Header().Set("Location", ts.URL+"?ReturnUrl=~%2f&State=1234567890")
+					w.WriteHeader(http.StatusFound)
+				}
+			}))
+			defer ts.Close()
+			client := NewClient(WithBaseUrl(ts.URL))
+
+			if err := client.Login(tt.args.username, tt.args.password); (err != nil) != tt.wantErr {
+				t.Errorf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_endpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		path    string
+		want    string
+	}{
+		{
+			name:    "Default",
+			options: []Option{},
+			path:    "/login.cshtml",
+			want:    "https://portal.ncaas.nl/login.cshtml",
+		},
+		{
+			name:    "Namespace",
+			options: []Option{WithNamespace("acme")},
+			path:    "/login.cshtml",
+			want:    "https://portal.ncaas.nl/acme/login.cshtml",
+		},
+		{
+			name:    "Base url and namespace",
+			options: []Option{WithBaseUrl("http://localhost:8080"), WithNamespace("acme")},
+			path:    "/login.cshtml",
+			want:    "http://localhost:8080/acme/login.cshtml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClient(tt.options...).endpoint(tt.path); got != tt.want {
+				t.Errorf("endpoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func isErrorOfType(err error, want interface{}) bool {
+	if want == nil {
+		return err == nil
+	}
+
+	return err != nil && reflect.TypeOf(err) == reflect.TypeOf(want)
+}
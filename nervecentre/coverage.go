@@ -0,0 +1,110 @@
+package nervecentre
+
+import (
+	"sort"
+	"time"
+)
+
+type GapKind string
+
+const (
+	// GapUncovered is a time range in which nobody is on call
+	GapUncovered GapKind = "uncovered"
+	// GapUnderstaffed is a time range with fewer members than MinMembers
+	GapUnderstaffed GapKind = "understaffed"
+	// GapOverstaffed is a time range with more members than MaxMembers
+	GapOverstaffed GapKind = "overstaffed"
+)
+
+// CoverageGap is a time range in which the members on call do not meet the staffing of the schedule. Members holds the
+// member ids on call, sorted.
+type CoverageGap struct {
+	Kind       GapKind
+	Start      time.Time
+	End        time.Time
+	Members    []string
+	MinMembers int
+	MaxMembers int
+}
+
+func (gap *CoverageGap) GetMembers(users []Member) []string {
+	return memberNames(gap.Members, users)
+}
+
+// CoverageGaps returns the time ranges between from and to in which nobody is on call, or fewer than MinMembers or
+// more than MaxMembers are. Only time that is covered by a predefined or base slot is checked, the staffing of a
+// predefined slot takes precedence over that of the base slot. Consecutive ranges with the same gap are joined.
+func (planning *Planning) CoverageGaps(from time.Time, to time.Time) []CoverageGap {
+	effective := planning.EffectiveTimeSlots()
+	boundaries := []time.Time{from, to}
+
+	for _, slots := range [][]Slot{effective, planning.PredefinedTimeSlots} {
+		for _, slot := range slots {
+			for _, boundary := range []time.Time{slot.Start, slot.End} {
+				if boundary.After(from) && boundary.Before(to) {
+					boundaries = append(boundaries, boundary)
+				}
+			}
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	gaps := make([]CoverageGap, 0)
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		start, end := boundaries[i], boundaries[i+1]
+
+		if !start.Before(end) {
+			continue
+		}
+
+		requirement := findSlot(planning.PredefinedTimeSlots, start, false)
+		requirements := planning.PredefinedTimeSlots
+
+		if requirement < 0 {
+			requirement = findSlot(planning.BaseTimeSlots, start, false)
+			requirements = planning.BaseTimeSlots
+		}
+
+		if requirement < 0 {
+			continue
+		}
+
+		minMembers := requirements[requirement].MinMembers
+		maxMembers := requirements[requirement].MaxMembers
+		members := slotMembers(effective, start)
+
+		var kind GapKind
+
+		switch {
+		case len(members) == 0:
+			kind = GapUncovered
+		case len(members) < minMembers:
+			kind = GapUnderstaffed
+		case maxMembers > 0 && len(members) > maxMembers:
+			kind = GapOverstaffed
+		default:
+			continue
+		}
+
+		if last := len(gaps) - 1; last >= 0 && gaps[last].End.Equal(start) && gaps[last].Kind == kind &&
+			sameMembers(gaps[last].Members, members) && gaps[last].MinMembers == minMembers && gaps[last].MaxMembers == maxMembers {
+			gaps[last].End = end
+			continue
+		}
+
+		gaps = append(gaps, CoverageGap{
+			Kind:       kind,
+			Start:      start,
+			End:        end,
+			Members:    members,
+			MinMembers: minMembers,
+			MaxMembers: maxMembers,
+		})
+	}
+
+	return gaps
+}
@@ -0,0 +1,111 @@
+package nervecentre
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanning_CoverageGaps(t *testing.T) {
+	day := func(hour int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+	}
+	tests := []struct {
+		name     string
+		planning *Planning
+		from     time.Time
+		to       time.Time
+		want     []CoverageGap
+	}{
+		{
+			name: "Fully covered",
+			planning: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(24), Members: []string{"1"}, MinMembers: 1, MaxMembers: 2},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []CoverageGap{},
+		},
+		{
+			name: "Empty slot",
+			planning: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(8), Members: []string{"1"}},
+					{Start: day(8), End: day(17)},
+					{Start: day(17), End: day(24), Members: []string{"1"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []CoverageGap{
+				{Kind: GapUncovered, Start: day(8), End: day(17)},
+			},
+		},
+		{
+			name: "Primary slot covers an empty base slot",
+			planning: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(24)},
+				},
+				PrimaryTimeSlots: []Slot{
+					{Start: day(0), End: day(12), Members: []string{"2"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []CoverageGap{
+				{Kind: GapUncovered, Start: day(12), End: day(24)},
+			},
+		},
+		{
+			name: "Understaffed and overstaffed by predefined slots",
+			planning: &Planning{
+				PredefinedTimeSlots: []Slot{
+					{Start: day(0), End: day(12), MinMembers: 2, MaxMembers: 3},
+					{Start: day(12), End: day(24), MinMembers: 1, MaxMembers: 1},
+				},
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(24), Members: []string{"2", "1"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []CoverageGap{
+				{Kind: GapOverstaffed, Start: day(12), End: day(24), Members: []string{"1", "2"}, MinMembers: 1, MaxMembers: 1},
+			},
+		},
+		{
+			name: "Only between from and to",
+			planning: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(24), Members: []string{"1"}, MinMembers: 2},
+				},
+			},
+			from: day(18),
+			to:   day(24),
+			want: []CoverageGap{
+				{Kind: GapUnderstaffed, Start: day(18), End: day(24), Members: []string{"1"}, MinMembers: 2},
+			},
+		},
+		{
+			name: "Time without slots is not checked",
+			planning: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(17), End: day(24), Members: []string{"1"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []CoverageGap{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.planning.CoverageGaps(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CoverageGaps() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
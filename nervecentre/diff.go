@@ -0,0 +1,148 @@
+package nervecentre
+
+import (
+	"sort"
+	"time"
+)
+
+type ChangeKind string
+
+const (
+	// SlotAdded is a time range that had no members and now has
+	SlotAdded ChangeKind = "added"
+	// SlotRemoved is a time range that had members and now has none
+	SlotRemoved ChangeKind = "removed"
+	// SlotReassigned is a time range that has other members than before
+	SlotReassigned ChangeKind = "reassigned"
+)
+
+// SlotChange is a time range in which the members of the base or primary slots changed. Before and After hold member
+// ids, sorted.
+type SlotChange struct {
+	Kind    ChangeKind
+	Primary bool
+	Start   time.Time
+	End     time.Time
+	Before  []string
+	After   []string
+}
+
+func (change *SlotChange) GetBeforeMembers(users []Member) []string {
+	return memberNames(change.Before, users)
+}
+
+func (change *SlotChange) GetAfterMembers(users []Member) []string {
+	return memberNames(change.After, users)
+}
+
+// MergePlannings joins the plannings of several days into a single planning.
+func MergePlannings(plannings []*Planning) *Planning {
+	merged := &Planning{}
+
+	for _, planning := range plannings {
+		merged.BaseTimeSlots = append(merged.BaseTimeSlots, planning.BaseTimeSlots...)
+		merged.PrimaryTimeSlots = append(merged.PrimaryTimeSlots, planning.PrimaryTimeSlots...)
+		merged.PredefinedTimeSlots = append(merged.PredefinedTimeSlots, planning.PredefinedTimeSlots...)
+	}
+
+	return merged
+}
+
+// DiffPlanning compares the base and primary slots of previous and current between from and to. Slots are compared
+// by time rather than one by one, so a slot that is split or moved results in the time ranges whose members changed.
+// Consecutive ranges with the same change are joined. Changes of the base slots come before those of the primary
+// slots, each ordered by time.
+func DiffPlanning(previous *Planning, current *Planning, from time.Time, to time.Time) []SlotChange {
+	changes := diffSlots(previous.BaseTimeSlots, current.BaseTimeSlots, from, to, false)
+
+	return append(changes, diffSlots(previous.PrimaryTimeSlots, current.PrimaryTimeSlots, from, to, true)...)
+}
+
+func diffSlots(previous []Slot, current []Slot, from time.Time, to time.Time, primary bool) []SlotChange {
+	boundaries := []time.Time{from, to}
+
+	for _, slots := range [][]Slot{previous, current} {
+		for _, slot := range slots {
+			for _, boundary := range []time.Time{slot.Start, slot.End} {
+				if boundary.After(from) && boundary.Before(to) {
+					boundaries = append(boundaries, boundary)
+				}
+			}
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	changes := make([]SlotChange, 0)
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		start, end := boundaries[i], boundaries[i+1]
+
+		if !start.Before(end) {
+			continue
+		}
+
+		before := slotMembers(previous, start)
+		after := slotMembers(current, start)
+
+		if sameMembers(before, after) {
+			continue
+		}
+
+		kind := SlotReassigned
+
+		switch {
+		case len(before) == 0:
+			kind = SlotAdded
+		case len(after) == 0:
+			kind = SlotRemoved
+		}
+
+		if last := len(changes) - 1; last >= 0 && changes[last].End.Equal(start) && changes[last].Kind == kind &&
+			sameMembers(changes[last].Before, before) && sameMembers(changes[last].After, after) {
+			changes[last].End = end
+			continue
+		}
+
+		changes = append(changes, SlotChange{
+			Kind:    kind,
+			Primary: primary,
+			Start:   start,
+			End:     end,
+			Before:  before,
+			After:   after,
+		})
+	}
+
+	return changes
+}
+
+// slotMembers returns the sorted members of the slot with members at time, if any.
+func slotMembers(slots []Slot, time time.Time) []string {
+	index := findSlot(slots, time, true)
+
+	if index < 0 {
+		return nil
+	}
+
+	members := append([]string(nil), slots[index].Members...)
+	sort.Strings(members)
+
+	return members
+}
+
+func sameMembers(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
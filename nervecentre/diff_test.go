@@ -0,0 +1,102 @@
+package nervecentre
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffPlanning(t *testing.T) {
+	day := func(hour int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+	}
+	previous := &Planning{
+		BaseTimeSlots: []Slot{
+			{Start: day(0), End: day(8), Members: []string{"1"}},
+			{Start: day(8), End: day(17), Members: []string{"2"}},
+			{Start: day(17), End: day(24), Members: []string{"3"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		current *Planning
+		from    time.Time
+		to      time.Time
+		want    []SlotChange
+	}{
+		{
+			name:    "Unchanged",
+			current: previous,
+			from:    day(0),
+			to:      day(24),
+			want:    []SlotChange{},
+		},
+		{
+			name: "Reassigned",
+			current: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(8), Members: []string{"1"}},
+					{Start: day(8), End: day(17), Members: []string{"4"}},
+					{Start: day(17), End: day(24), Members: []string{"3"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []SlotChange{
+				{Kind: SlotReassigned, Start: day(8), End: day(17), Before: []string{"2"}, After: []string{"4"}},
+			},
+		},
+		{
+			name: "Split and emptied",
+			current: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(8), Members: []string{"1"}},
+					{Start: day(8), End: day(12), Members: []string{"2"}},
+					{Start: day(12), End: day(17)},
+					{Start: day(17), End: day(24), Members: []string{"3"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []SlotChange{
+				{Kind: SlotRemoved, Start: day(12), End: day(17), Before: []string{"2"}},
+			},
+		},
+		{
+			name: "Primary slot added",
+			current: &Planning{
+				BaseTimeSlots: previous.BaseTimeSlots,
+				PrimaryTimeSlots: []Slot{
+					{Start: day(10), End: day(12), Members: []string{"5"}},
+				},
+			},
+			from: day(0),
+			to:   day(24),
+			want: []SlotChange{
+				{Kind: SlotAdded, Primary: true, Start: day(10), End: day(12), After: []string{"5"}},
+			},
+		},
+		{
+			name: "Only between from and to",
+			current: &Planning{
+				BaseTimeSlots: []Slot{
+					{Start: day(0), End: day(8), Members: []string{"4"}},
+					{Start: day(8), End: day(17), Members: []string{"4"}},
+				},
+			},
+			from: day(6),
+			to:   day(12),
+			want: []SlotChange{
+				{Kind: SlotReassigned, Start: day(6), End: day(8), Before: []string{"1"}, After: []string{"4"}},
+				{Kind: SlotReassigned, Start: day(8), End: day(12), Before: []string{"2"}, After: []string{"4"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffPlanning(previous, tt.current, tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffPlanning() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
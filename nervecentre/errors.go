@@ -0,0 +1,59 @@
+package nervecentre
+
+import (
+	"fmt"
+)
+
+// NetworkError is returned when Nerve Centre could not be reached or the response could not be read.
+type NetworkError struct {
+	Endpoint string
+	Err      error
+}
+
+func (err *NetworkError) Error() string {
+	return fmt.Sprintf("could not reach Nerve Centre at %s: %v", err.Endpoint, err.Err)
+}
+
+func (err *NetworkError) Unwrap() error {
+	return err.Err
+}
+
+// StatusError is returned when Nerve Centre responds with an unexpected status.
+type StatusError struct {
+	Endpoint string
+	Status   int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("Nerve Centre returned %d for %s", err.Status, err.Endpoint)
+}
+
+// AuthenticationError is returned when logging in fails or when the session is no longer accepted.
+type AuthenticationError struct {
+	Endpoint string
+	Status   int
+	Reason   string
+}
+
+func (err *AuthenticationError) Error() string {
+	if err.Status == 0 {
+		return fmt.Sprintf("failed to login at %s: %s", err.Endpoint, err.Reason)
+	}
+
+	return fmt.Sprintf("failed to login at %s, Nerve Centre returned %d", err.Endpoint, err.Status)
+}
+
+// DecodeError is returned when the response of Nerve Centre does not have the expected shape.
+type DecodeError struct {
+	Endpoint string
+	Status   int
+	Err      error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode response of %s (status %d): %v", err.Endpoint, err.Status, err.Err)
+}
+
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
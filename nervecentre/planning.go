@@ -0,0 +1,252 @@
+package nervecentre
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type Slot struct {
+	Start   time.Time
+	End     time.Time
+	Members []string
+	// MinMembers and MaxMembers are the staffing the slot requires, a MaxMembers of 0 means there is no maximum
+	MinMembers int
+	MaxMembers int
+	// Backup holds the base members of an effective slot in which a primary slot took over
+	Backup []string `json:"-"`
+}
+
+type Planning struct {
+	BaseTimeSlots    []Slot
+	PrimaryTimeSlots []Slot
+	// PredefinedTimeSlots are the slots the schedule is set up with, without members
+	PredefinedTimeSlots []Slot
+}
+
+func fixTimeZoneForPlanning(planning *Planning, loc *time.Location) {
+	for i, _ := range planning.BaseTimeSlots {
+		slot := &planning.BaseTimeSlots[i]
+		slot.Start = fixTimeZone(slot.Start, loc)
+		slot.End = fixTimeZone(slot.End, loc)
+	}
+	for i, _ := range planning.PrimaryTimeSlots {
+		slot := &planning.PrimaryTimeSlots[i]
+		slot.Start = fixTimeZone(slot.Start, loc)
+		slot.End = fixTimeZone(slot.End, loc)
+	}
+	for i, _ := range planning.PredefinedTimeSlots {
+		slot := &planning.PredefinedTimeSlots[i]
+		slot.Start = fixTimeZone(slot.Start, loc)
+		slot.End = fixTimeZone(slot.End, loc)
+	}
+}
+
+func fixTimeZone(toFix time.Time, loc *time.Location) time.Time {
+	// Nerve Centre has the nerve to communicate local times as if they were Zulu, so we have to update te location
+	return time.Date(
+		toFix.Year(),
+		toFix.Month(),
+		toFix.Day(),
+		toFix.Hour(),
+		toFix.Minute(),
+		toFix.Second(),
+		0,
+		loc,
+	)
+}
+
+func (planning *Planning) HasMembers() bool {
+	for _, slot := range planning.EffectiveTimeSlots() {
+		if len(slot.Members) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (planning *Planning) GetActiveSlot(time time.Time) *Slot {
+	for _, slot := range planning.EffectiveTimeSlots() {
+		if (slot.Start.Before(time) || slot.Start.Equal(time)) && slot.End.After(time) {
+			return &slot
+		}
+	}
+
+	return nil
+}
+
+// EffectiveTimeSlots overlays the primary slots on the base slots. Where a primary slot with members overlaps a base
+// slot, the primary members are on call and the base members become the backup. Base slots are only split at the
+// boundaries of primary slots.
+func (planning *Planning) EffectiveTimeSlots() []Slot {
+	if len(planning.PrimaryTimeSlots) == 0 {
+		return planning.BaseTimeSlots
+	}
+
+	boundaries := make([]time.Time, 0, 2*(len(planning.BaseTimeSlots)+len(planning.PrimaryTimeSlots)))
+
+	for _, slot := range planning.BaseTimeSlots {
+		boundaries = append(boundaries, slot.Start, slot.End)
+	}
+
+	for _, slot := range planning.PrimaryTimeSlots {
+		if len(slot.Members) > 0 {
+			boundaries = append(boundaries, slot.Start, slot.End)
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	slots := make([]Slot, 0, len(planning.BaseTimeSlots))
+	lastBase, lastPrimary := -1, -1
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		start, end := boundaries[i], boundaries[i+1]
+
+		if !start.Before(end) {
+			continue
+		}
+
+		base := findSlot(planning.BaseTimeSlots, start, false)
+		primary := findSlot(planning.PrimaryTimeSlots, start, true)
+
+		if base < 0 && primary < 0 {
+			continue
+		}
+
+		// Pieces of the same base and primary slot are joined again
+		if len(slots) > 0 && base == lastBase && primary == lastPrimary && slots[len(slots)-1].End.Equal(start) {
+			slots[len(slots)-1].End = end
+			continue
+		}
+
+		var slot Slot
+
+		if primary < 0 {
+			slot = planning.BaseTimeSlots[base]
+		} else {
+			slot = planning.PrimaryTimeSlots[primary]
+
+			if base >= 0 {
+				baseSlot := planning.BaseTimeSlots[base]
+				slot.Backup = baseSlot.Members
+			}
+		}
+
+		slot.Start = start
+		slot.End = end
+
+		slots = append(slots, slot)
+		lastBase, lastPrimary = base, primary
+	}
+
+	return slots
+}
+
+// EffectiveSlots returns the effective slots of the plannings of consecutive days in order. A slot that the planning
+// of the next day returns again is only returned once.
+func EffectiveSlots(plannings []*Planning) []Slot {
+	slots := make([]Slot, 0, len(plannings))
+
+	for _, planning := range plannings {
+		for _, slot := range planning.EffectiveTimeSlots() {
+			if last := len(slots) - 1; last >= 0 && slot.Start.Before(slots[last].End) {
+				continue
+			}
+
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots
+}
+
+func findSlot(slots []Slot, time time.Time, withMembers bool) int {
+	for i, slot := range slots {
+		if withMembers && len(slot.Members) == 0 {
+			continue
+		}
+
+		if (slot.Start.Before(time) || slot.Start.Equal(time)) && slot.End.After(time) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (slot *Slot) GetMembers(users []Member) []string {
+	if slot == nil {
+		return make([]string, 0, 0)
+	}
+
+	return memberNames(slot.Members, users)
+}
+
+func (slot *Slot) GetBackupMembers(users []Member) []string {
+	if slot == nil {
+		return make([]string, 0, 0)
+	}
+
+	return memberNames(slot.Backup, users)
+}
+
+// GetMemberList returns the members of the slot that are known in users.
+func (slot *Slot) GetMemberList(users []Member) []Member {
+	if slot == nil {
+		return make([]Member, 0)
+	}
+
+	return memberList(slot.Members, users)
+}
+
+// GetBackupMemberList returns the backup members of the slot that are known in users.
+func (slot *Slot) GetBackupMemberList(users []Member) []Member {
+	if slot == nil {
+		return make([]Member, 0)
+	}
+
+	return memberList(slot.Backup, users)
+}
+
+func memberList(ids []string, users []Member) []Member {
+	members := make([]Member, 0)
+
+	for _, id := range ids {
+		for _, user := range users {
+			if user.UserId == id {
+				members = append(members, user)
+				break
+			}
+		}
+	}
+
+	return members
+}
+
+func memberNames(ids []string, users []Member) []string {
+	index := make(map[string]string)
+
+	for _, user := range users {
+		index[user.UserId] = strings.TrimSpace(user.Name)
+	}
+
+	members := make(map[string]struct{})
+
+	for _, member := range ids {
+		members[index[member]] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(members))
+
+	for key, _ := range members {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -1,241 +1,12 @@
-package main
+package nervecentre
 
 import (
 	"4d63.com/tz"
-	"encoding/json"
-	"net/http"
-	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
 )
 
-func TestGetPlanning(t *testing.T) {
-	loc, _ := tz.LoadLocation("Europe/Amsterdam")
-	type args struct {
-		schedule Schedule
-		date     time.Time
-	}
-	tests := []struct {
-		name    string
-		status  int
-		json    string
-		args    args
-		wantErr bool
-		want    *Planning
-	}{
-		{
-			name: "Planning for Schedule",
-			args: args{
-				schedule: Schedule{
-					GroupName:   "GroupName",
-					ParameterId: "P1",
-					GroupId:     "G1",
-				},
-				date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-			},
-			status: http.StatusOK,
-			json: `
-			{
-			  "enableManualPlanning": false,
-			  "enablePrimarySchedule": true,
-			  "predefinedTimeSlots": [
-				{
-				  "start": "2021-05-31T00:00:00Z",
-				  "end": "2021-06-01T00:00:00Z",
-				  "minMembers": 1,
-				  "maxMembers": 2
-				}
-			  ],
-			  "baseTimeSlots": [
-				{
-				  "members": [
-					"a9f656bf-85af-415b-807c-81728f255f03"
-				  ],
-				  "start": "2021-05-31T00:00:00Z",
-				  "end": "2021-06-01T00:00:00Z",
-				  "minMembers": 1,
-				  "maxMembers": 2
-				}
-			  ],
-			  "primaryTimeSlots": []
-			}
-`,
-			wantErr: false,
-			want: &Planning{
-				PrimaryTimeSlots: []Slot{},
-				BaseTimeSlots: []Slot{
-					{
-						Start: time.Date(2021, 5, 31, 0, 0, 0, 0, loc),
-						End:   time.Date(2021, 6, 1, 0, 0, 0, 0, loc),
-						Members: []string{
-							"a9f656bf-85af-415b-807c-81728f255f03",
-						},
-					},
-				},
-			},
-		},
-		{
-			name: "Planning for Schedule returns error",
-			args: args{
-				schedule: Schedule{
-					GroupName:   "GroupName",
-					ParameterId: "P1",
-					GroupId:     "G1",
-				},
-				date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-			},
-			status:  http.StatusInternalServerError,
-			json:    "",
-			wantErr: true,
-			want:    nil,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(tt.status)
-				w.Write([]byte(tt.json))
-			}))
-			defer ts.Close()
-			nerveCentreBaseUrl = ts.URL
-
-			got, err := GetPlanning(tt.args.schedule, tt.args.date)
-
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GetPlanning() = %v, want %v", got, tt.want)
-			}
-
-			if (err != nil) != tt.wantErr {
-				t.Errorf("GetPlanning() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestGetSchedules(t *testing.T) {
-	tests := []struct {
-		name string
-		want *[]Schedule
-	}{
-		{
-			name: "Single Schedule",
-			want: &[]Schedule{
-				{
-					GroupName:   "GroupName",
-					ParameterId: "P1",
-					GroupId:     "G1",
-				},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				body, _ := json.Marshal(tt.want)
-				w.WriteHeader(http.StatusOK)
-				w.Write(body)
-			}))
-			defer ts.Close()
-			nerveCentreBaseUrl = ts.URL
-			if got := GetSchedules(); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GetSchedules() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestGetUsers(t *testing.T) {
-	tests := []struct {
-		name string
-		want *[]Member
-	}{
-		{
-			"Single Member",
-			&[]Member{
-				{
-					UserId: "1",
-					Name:   "alice",
-				},
-			},
-		},
-		{
-			"Two Users",
-			&[]Member{
-				{
-					UserId: "1",
-					Name:   "alice",
-				},
-				{
-					UserId: "2",
-					Name:   "bob",
-				},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				body, _ := json.Marshal(tt.want)
-				w.WriteHeader(http.StatusOK)
-				w.Write(body)
-			}))
-			defer ts.Close()
-			nerveCentreBaseUrl = ts.URL
-			if got := GetMembers(); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GetMembers() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestLogin(t *testing.T) {
-	type args struct {
-		username string
-		password string
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{
-			name: "Success",
-			args: args{
-				username: "bob",
-				password: "alice",
-			},
-			wantErr: false,
-		},
-		{
-			name: "Failure",
-			args: args{
-				username: "bob",
-				password: "alice",
-			},
-			wantErr: true,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if tt.wantErr {
-					w.WriteHeader(http.StatusForbidden)
-				} else {
-					w.Header().Set("Location", nerveCentreBaseUrl+"?ReturnUrl=~%2f&State=1234567890")
-					w.WriteHeader(http.StatusFound)
-				}
-			}))
-			defer ts.Close()
-			nerveCentreBaseUrl = ts.URL
-
-			if err := Login(tt.args.username, tt.args.password); (err != nil) != tt.wantErr {
-				t.Errorf("Login() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestPlanning_HasMembers(t *testing.T) {
 	type fields struct {
 		BaseTimeSlots    []Slot
@@ -296,6 +67,26 @@ func TestPlanning_HasMembers(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "Primary Slot with Members",
+			fields: fields{
+				BaseTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 1, 23, 59, 59, 0, time.UTC),
+						Members: []string{},
+					},
+				},
+				PrimaryTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
+						Members: []string{"1"},
+					},
+				},
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -312,9 +103,9 @@ func TestPlanning_HasMembers(t *testing.T) {
 
 func TestSlot_GetMembers(t *testing.T) {
 	type args struct {
-		users *[]Member
+		users []Member
 	}
-	users := &[]Member{
+	users := []Member{
 		{
 			UserId: "1",
 			Name:   "Alice",
@@ -495,3 +286,217 @@ func sameStringSlice(x, y []string) bool {
 	}
 	return len(diff) == 0
 }
+
+func TestPlanning_EffectiveTimeSlots(t *testing.T) {
+	type fields struct {
+		BaseTimeSlots    []Slot
+		PrimaryTimeSlots []Slot
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   []Slot
+	}{
+		{
+			name: "Only base slots",
+			fields: fields{
+				BaseTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+						Members: []string{"1"},
+					},
+				},
+			},
+			want: []Slot{
+				{
+					Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+					Members: []string{"1"},
+				},
+			},
+		},
+		{
+			name: "Primary slot overrides the night",
+			fields: fields{
+				BaseTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+						Members: []string{"1"},
+					},
+					{
+						Start:   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+						Members: []string{"1"},
+					},
+				},
+				PrimaryTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 18, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+						Members: []string{"2"},
+					},
+					{
+						Start:   time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 2, 18, 0, 0, 0, time.UTC),
+						Members: []string{},
+					},
+				},
+			},
+			want: []Slot{
+				{
+					Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 1, 18, 0, 0, 0, time.UTC),
+					Members: []string{"1"},
+				},
+				{
+					Start:   time.Date(2021, 1, 1, 18, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+					Members: []string{"2"},
+					Backup:  []string{"1"},
+				},
+				{
+					Start:   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+					Members: []string{"2"},
+					Backup:  []string{"1"},
+				},
+				{
+					Start:   time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+					Members: []string{"1"},
+				},
+			},
+		},
+		{
+			name: "Primary slot outside of base slots",
+			fields: fields{
+				BaseTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+						Members: []string{},
+					},
+				},
+				PrimaryTimeSlots: []Slot{
+					{
+						Start:   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+						End:     time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+						Members: []string{"2"},
+					},
+				},
+			},
+			want: []Slot{
+				{
+					Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+					Members: []string{},
+				},
+				{
+					Start:   time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+					Members: []string{"2"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planning := &Planning{
+				BaseTimeSlots:    tt.fields.BaseTimeSlots,
+				PrimaryTimeSlots: tt.fields.PrimaryTimeSlots,
+			}
+			if got := planning.EffectiveTimeSlots(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectiveTimeSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveSlots(t *testing.T) {
+	day := func(day int) time.Time {
+		return time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC)
+	}
+	plannings := []*Planning{
+		{
+			BaseTimeSlots: []Slot{{Start: day(1), End: day(2), Members: []string{"1"}}},
+		},
+		{
+			// The planning of a day can return the last slot of the day before again
+			BaseTimeSlots: []Slot{
+				{Start: day(1), End: day(2), Members: []string{"1"}},
+				{Start: day(2), End: day(3), Members: []string{"2"}},
+			},
+		},
+	}
+
+	want := []Slot{
+		{Start: day(1), End: day(2), Members: []string{"1"}},
+		{Start: day(2), End: day(3), Members: []string{"2"}},
+	}
+
+	if got := EffectiveSlots(plannings); !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveSlots() = %v, want %v", got, want)
+	}
+}
+
+func TestFixTimeZone(t *testing.T) {
+	amsterdam, _ := tz.LoadLocation("Europe/Amsterdam")
+	lisbon, _ := tz.LoadLocation("Europe/Lisbon")
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		loc   *time.Location
+		want  time.Duration
+	}{
+		{
+			name:  "Regular day in Amsterdam",
+			start: time.Date(2021, 5, 31, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			loc:   amsterdam,
+			want:  24 * time.Hour,
+		},
+		{
+			name:  "DST starts in Amsterdam",
+			start: time.Date(2021, 3, 28, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 3, 29, 0, 0, 0, 0, time.UTC),
+			loc:   amsterdam,
+			want:  23 * time.Hour,
+		},
+		{
+			name:  "DST ends in Amsterdam",
+			start: time.Date(2021, 10, 31, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+			loc:   amsterdam,
+			want:  25 * time.Hour,
+		},
+		{
+			name:  "DST starts in Lisbon",
+			start: time.Date(2021, 3, 28, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 3, 29, 0, 0, 0, 0, time.UTC),
+			loc:   lisbon,
+			want:  23 * time.Hour,
+		},
+		{
+			name:  "Handover during the skipped hour",
+			start: time.Date(2021, 3, 28, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 3, 28, 2, 30, 0, 0, time.UTC),
+			loc:   amsterdam,
+			want:  2*time.Hour + 30*time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := fixTimeZone(tt.start, tt.loc)
+			end := fixTimeZone(tt.end, tt.loc)
+			if start.Location() != tt.loc || start.Hour() != tt.start.Hour() {
+				t.Errorf("fixTimeZone() = %v, want %v in %v", start, tt.start.Format("15:04"), tt.loc)
+			}
+			if got := end.Sub(start); got != tt.want {
+				t.Errorf("fixTimeZone() slot lasts %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
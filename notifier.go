@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Notifier sends the messages of the runner to a destination, rendered for the chat service of that destination.
+type Notifier interface {
+	// Notify sends the overview of one or more schedules
+	Notify(ctx context.Context, overviews []*Overview) error
+	// NotifyFailure reports that the wachtdienst of schedule could not be fetched, schedule is empty when the tenant
+	// itself failed
+	NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error
+	// Send sends a message of the other tasks
+	Send(ctx context.Context, message *Message) error
+}
+
+const (
+	TypeSlack      = "slack"
+	TypeTeams      = "teams"
+	TypeMattermost = "mattermost"
+	TypeDiscord    = "discord"
+	TypeEmail      = "email"
+	TypeGeneric    = "generic"
+)
+
+// Types are the chat services a destination can post to, an empty type is TypeSlack.
+var Types = []string{TypeSlack, TypeTeams, TypeMattermost, TypeDiscord, TypeEmail, TypeGeneric}
+
+// NewNotifier returns the notifier of destination, api is used by Slack destinations that post with the Web API.
+func NewNotifier(destination DestinationConfig, format string, api *SlackApi) Notifier {
+	switch destination.Type {
+	case TypeTeams:
+		return &TeamsNotifier{Webhook: destination.Webhook}
+	case TypeMattermost:
+		return &MattermostNotifier{Webhook: destination.Webhook, Channel: destination.Channel}
+	case TypeDiscord:
+		return &DiscordNotifier{Webhook: destination.Webhook}
+	case TypeEmail:
+		return &EmailNotifier{Config: destination.Email}
+	case TypeGeneric:
+		return &GenericNotifier{Url: destination.Webhook, Request: destination.Request}
+	default:
+		notifier := &SlackNotifier{Webhook: destination.Webhook, Channel: destination.Channel, Format: format}
+
+		if destination.UsesApi() {
+			notifier.Api = api
+		}
+
+		return notifier
+	}
+}
+
+// SlackNotifier posts to a Slack webhook, or to Channel with the Slack Web API when Api is set.
+type SlackNotifier struct {
+	Webhook string
+	Channel string
+	// Format is FormatAttachments or FormatBlocks
+	Format string
+	Api    *SlackApi
+	// Mentions maps the names of members that have a Slack user to a mention of that user
+	Mentions map[string]string
+}
+
+func (notifier *SlackNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	return notifier.post(ctx, notifier.overviewPayload(overviews))
+}
+
+func (notifier *SlackNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	return notifier.post(ctx, &SlackPayload{
+		Username: "⚠️ Wachtdienst " + schedule.GroupName,
+		Text:     "Kon wachtdiensten niet ophalen uit Nerve Centre: " + message,
+	})
+}
+
+func (notifier *SlackNotifier) Send(ctx context.Context, message *Message) error {
+	return notifier.post(ctx, notifier.payload(message))
+}
+
+// payload renders message with an attachment for every section.
+func (notifier *SlackNotifier) payload(message *Message) *SlackPayload {
+	return &SlackPayload{
+		Username:    message.Username(),
+		Text:        message.Text.Render(notifier.Mentions),
+		Attachments: SlackAttachments(message.Sections, notifier.Mentions),
+	}
+}
+
+// overviewPayload renders the overviews in the format of the notifier, the blocks of combined overviews are separated
+// by a divider.
+func (notifier *SlackNotifier) overviewPayload(overviews []*Overview) *SlackPayload {
+	message := OverviewMessage(overviews)
+
+	if notifier.Format != FormatBlocks {
+		return notifier.payload(message)
+	}
+
+	payload := &SlackPayload{Username: message.Username(), Text: message.Text.String()}
+
+	if len(overviews) == 1 {
+		payload.Blocks = overviews[0].Blocks("", notifier.Mentions)
+		return payload
+	}
+
+	for i, overview := range overviews {
+		if i > 0 {
+			payload.Blocks = append(payload.Blocks, DividerBlock())
+		}
+
+		payload.Blocks = append(payload.Blocks, overview.Blocks(overview.Schedule.GroupName, notifier.Mentions)...)
+	}
+
+	return payload
+}
+
+// SlackAttachments renders sections as attachments coloured by their severity, mentioning the members that have a
+// mention. The time of a section is the timestamp of its attachment.
+func SlackAttachments(sections []Section, mentions map[string]string) []Attachment {
+	attachments := make([]Attachment, 0, len(sections))
+
+	for _, section := range sections {
+		text := section.Text.Render(mentions)
+		attachment := Attachment{
+			Fallback: section.Title + ": " + text,
+			Color:    severityColors[section.Severity],
+			Title:    section.Title,
+			Text:     text,
+		}
+
+		if !section.Time.IsZero() {
+			attachment.Ts = json.Number(strconv.FormatInt(section.Time.Unix(), 10))
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments
+}
+
+func (notifier *SlackNotifier) post(ctx context.Context, message *SlackPayload) error {
+	if message.Channel == "" {
+		message.Channel = notifier.Channel
+	}
+
+	if notifier.Api != nil {
+		_, _, err := notifier.Api.PostMessage(ctx, message)
+		return err
+	}
+
+	return SendSlackContext(ctx, notifier.Webhook, message)
+}
+
+// PostOverview updates the overview posted before as previous, or posts a new one when previous is nil or was deleted
+// in the meantime. It returns the message that holds the overview, which is posted at now when it is new. Api must be
+// set.
+func (notifier *SlackNotifier) PostOverview(ctx context.Context, overviews []*Overview, previous *MessageState, now time.Time) (MessageState, error) {
+	message := notifier.overviewPayload(overviews)
+	message.Channel = notifier.Channel
+
+	if previous != nil {
+		err := notifier.Api.UpdateMessage(ctx, previous.Channel, previous.Ts, message)
+
+		if err == nil {
+			return *previous, nil
+		}
+
+		var apiError *SlackApiError
+
+		if !errors.As(err, &apiError) || apiError.Code != "message_not_found" {
+			return *previous, err
+		}
+	}
+
+	channel, ts, err := notifier.Api.PostMessage(ctx, message)
+
+	if err != nil {
+		return MessageState{}, err
+	}
+
+	return MessageState{Channel: channel, Ts: ts, Posted: now}, nil
+}
+
+// postJson posts payload as JSON to the webhook of service, any 2xx status is a success.
+func postJson(ctx context.Context, service string, webhook string, payload interface{}) error {
+	if len(webhook) == 0 {
+		return fmt.Errorf("no webhook url was provided")
+	}
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return fmt.Errorf("could not encode %s notification: %w", service, err)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("could not send %s notification: %w", service, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("could not send %s notification, service returned %d", service, resp.StatusCode)
+	}
+
+	return nil
+}
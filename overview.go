@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Overview struct {
+	Schedule       nervecentre.Schedule
+	Location       *time.Location
+	Current        []string
+	CurrentBackup  []string
+	CurrentEnd     time.Time
+	Next           *nervecentre.Slot
+	NextMembers    []string
+	NextBackup     []string
+	RosterEnd      time.Time
+	HasRoster      bool
+	HorizonReached bool
+	Horizon        Days
+	// Shifts are the wachtdiensten from the current one until the end of the roster
+	Shifts []Shift
+	// Time is the time the overview was made at
+	Time time.Time
+}
+
+// Shift is a time range in which the same members are on call, joining consecutive slots. Members and Backup hold the
+// sorted names, MemberList and BackupList the members themselves in the order of Nerve Centre.
+type Shift struct {
+	Start      time.Time
+	End        time.Time
+	Members    []string
+	Backup     []string
+	MemberList []nervecentre.Member
+	BackupList []nervecentre.Member
+}
+
+func BuildOverview(ctx context.Context, client *nervecentre.Client, schedule nervecentre.Schedule, users []nervecentre.Member, runTime time.Time, horizon Days, concurrency int) (*Overview, error) {
+	plannings, err := client.GetPlannings(ctx, schedule, runTime, int(horizon), concurrency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	overview := NewOverview(schedule, users, plannings, runTime.In(client.Location(schedule)))
+	overview.Horizon = horizon
+	overview.HorizonReached = len(plannings) == int(horizon)
+
+	return overview, nil
+}
+
+func NewOverview(schedule nervecentre.Schedule, users []nervecentre.Member, plannings []*nervecentre.Planning, runTime time.Time) *Overview {
+	overview := &Overview{
+		Schedule:  schedule,
+		Location:  runTime.Location(),
+		RosterEnd: runTime,
+		Time:      runTime,
+	}
+
+	if len(plannings) == 0 {
+		return overview
+	}
+
+	slot := plannings[0].GetActiveSlot(runTime)
+	overview.HasRoster = len(slot.GetMembers(users)) > 0
+	overview.Current = slot.GetMembers(users)
+	overview.CurrentBackup = slot.GetBackupMembers(users)
+
+	if slot != nil {
+		overview.CurrentEnd = slot.End
+	}
+
+	// A slot that the planning of the next day returns again would otherwise become a shift twice
+	for _, slot := range nervecentre.EffectiveSlots(plannings) {
+
+		if slot.End.After(runTime) {
+			overview.addShift(slot, users)
+		}
+
+		// Filter current active slot and older slots
+		if runTime.After(slot.Start) || runTime.Equal(slot.Start) {
+			continue
+		}
+
+		overview.RosterEnd = slot.End
+
+		if overview.Next == nil {
+			members := slot.GetMembers(users)
+
+			if !Equal(overview.Current, members) {
+				next := slot
+				overview.Next = &next
+				overview.NextMembers = members
+				overview.NextBackup = slot.GetBackupMembers(users)
+			} else {
+				overview.CurrentEnd = slot.End
+			}
+		}
+	}
+
+	return overview
+}
+
+// addShift extends the last shift with slot when it directly follows with the same members, or starts a new shift.
+func (overview *Overview) addShift(slot nervecentre.Slot, users []nervecentre.Member) {
+	members := slot.GetMembers(users)
+	backup := slot.GetBackupMembers(users)
+
+	if last := len(overview.Shifts) - 1; last >= 0 && overview.Shifts[last].End.Equal(slot.Start) &&
+		Equal(overview.Shifts[last].Members, members) && Equal(overview.Shifts[last].Backup, backup) {
+		overview.Shifts[last].End = slot.End
+		return
+	}
+
+	overview.Shifts = append(overview.Shifts, Shift{
+		Start:      slot.Start,
+		End:        slot.End,
+		Members:    members,
+		Backup:     backup,
+		MemberList: slot.GetMemberList(users),
+		BackupList: slot.GetBackupMemberList(users),
+	})
+}
+
+// today returns the text about the members on call now, it needs attention when nobody is.
+func (overview *Overview) today() (Text, Severity) {
+	if len(overview.Current) == 0 {
+		return NewText("<<geen>>"), SeverityAttention
+	}
+
+	return Text{
+		{Members: overview.Current},
+		{Text: " tot " + overview.format(overview.CurrentEnd, "02-01-2006 15:04") + backupString(overview.CurrentBackup)},
+	}, SeverityGood
+}
+
+// next returns the text about the next members on call, it needs attention when it is not known. Next must be set.
+func (overview *Overview) next() (Text, Severity) {
+	if len(overview.Current) == 0 {
+		return NewText("<<geen>>"), SeverityAttention
+	}
+
+	return Text{
+		{Members: overview.NextMembers},
+		{Text: " op " + overview.format(overview.Next.Start, "02-01-2006 om 15:04") + backupString(overview.NextBackup)},
+	}, SeverityWarning
+}
+
+func (overview *Overview) rosterEnd() string {
+	if overview.HorizonReached {
+		return "Er is een rooster tot ten minste " + overview.format(overview.RosterEnd, "02-01-2006 15:04") +
+			", verder dan " + strconv.Itoa(int(overview.Horizon)) + " dagen vooruit is niet gekeken"
+	}
+
+	return "Er is een rooster tot " + overview.format(overview.RosterEnd, "02-01-2006 15:04")
+}
+
+// Sections returns a section for today, the next wachtdienst and the end of the roster, with titlePrefix in front of
+// their titles.
+func (overview *Overview) Sections(titlePrefix string) []Section {
+	today, todaySeverity := overview.today()
+	sections := make([]Section, 0, 3)
+
+	sections = append(sections, Section{
+		Title:    titlePrefix + "Vandaag",
+		Text:     today,
+		Severity: todaySeverity,
+	})
+
+	if overview.Next != nil {
+		next, nextSeverity := overview.next()
+
+		sections = append(sections, Section{
+			Title:    titlePrefix + "Volgende",
+			Text:     next,
+			Severity: nextSeverity,
+			Time:     overview.Next.Start,
+		})
+	}
+
+	if overview.HasRoster {
+		sections = append(sections, Section{
+			Title:    titlePrefix + "Einde rooster",
+			Text:     NewText(overview.rosterEnd()),
+			Severity: SeverityAttention,
+			Time:     overview.RosterEnd,
+		})
+	}
+
+	return sections
+}
+
+// Blocks renders the overview with Block Kit, as a section with a field for today and the next wachtdienst followed by
+// the end of the roster in small print, mentioning the members that have a mention. The header is left out when it is
+// empty.
+func (overview *Overview) Blocks(header string, mentions map[string]string) []Block {
+	blocks := make([]Block, 0, 3)
+
+	if header != "" {
+		blocks = append(blocks, HeaderBlock(header))
+	}
+
+	today, todaySeverity := overview.today()
+	fields := []*TextObject{MarkdownText(severityIcons[todaySeverity] + " *Vandaag*\n" + blockText(today, mentions))}
+
+	if overview.Next != nil {
+		next, nextSeverity := overview.next()
+		fields = append(fields, MarkdownText(severityIcons[nextSeverity]+" *Volgende*\n"+blockText(next, mentions)))
+	}
+
+	blocks = append(blocks, SectionBlock(nil, fields...))
+
+	if overview.HasRoster {
+		blocks = append(blocks, ContextBlock(MarkdownText(":spiral_calendar_pad: "+overview.rosterEnd())))
+	}
+
+	return blocks
+}
+
+// severityIcons are the emoji in front of a field of a Block Kit overview.
+var severityIcons = map[Severity]string{
+	SeverityGood:      ":large_green_circle:",
+	SeverityWarning:   ":large_yellow_circle:",
+	SeverityAttention: ":red_circle:",
+}
+
+// blockText renders text as markdown, a text without members like <<geen>> is escaped so it is shown as it is.
+func blockText(text Text, mentions map[string]string) string {
+	for _, part := range text {
+		if len(part.Members) > 0 {
+			return text.Render(mentions)
+		}
+	}
+
+	return escapeMarkdown(text.String())
+}
+
+const (
+	FormatAttachments = "attachments"
+	FormatBlocks      = "blocks"
+)
+
+// Formats are the ways a message can be rendered in Slack.
+var Formats = []string{FormatAttachments, FormatBlocks}
+
+// OverviewMessage returns the message with a single overview, or with several overviews combined.
+func OverviewMessage(overviews []*Overview) *Message {
+	message := &Message{Icon: "📞", Title: "Overzicht"}
+
+	if len(overviews) == 1 {
+		message.Schedule = overviews[0].Schedule
+		message.Text = NewText("Een overzicht van de de huidige wachtdiensten die zijn ingeregeld voor " + overviews[0].Schedule.GroupName + " in Nerve Centre")
+		message.Sections = overviews[0].Sections("")
+
+		return message
+	}
+
+	message.Text = NewText("Een overzicht van de huidige wachtdiensten die zijn ingeregeld in Nerve Centre")
+
+	for _, overview := range overviews {
+		message.Sections = append(message.Sections, overview.Sections(overview.Schedule.GroupName+": ")...)
+	}
+
+	return message
+}
+
+// Topic returns the members on call and until when, for a channel topic.
+func (overview *Overview) Topic() string {
+	if len(overview.Current) == 0 {
+		return "Wachtdienst: <<geen>>"
+	}
+
+	return "Wachtdienst: " + strings.Join(overview.Current, ", ") + " tot " + overview.format(overview.CurrentEnd, "02-01 15:04")
+}
+
+// escapeMarkdown escapes the characters Slack uses for links and mentions, so <<geen>> is shown as it is.
+func escapeMarkdown(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func (overview *Overview) format(time time.Time, layout string) string {
+	return time.In(overview.Location).Format(layout)
+}
+
+func backupString(backup []string) string {
+	if len(backup) == 0 {
+		return ""
+	}
+
+	return " (reserve: " + strings.Join(backup, ", ") + ")"
+}
+
+func FilterSchedules(schedules []nervecentre.Schedule, group string) []nervecentre.Schedule {
+	if group == "" {
+		return schedules
+	}
+
+	filtered := make([]nervecentre.Schedule, 0, len(schedules))
+
+	for _, schedule := range schedules {
+		if schedule.GroupId == group || strings.EqualFold(schedule.GroupName, group) {
+			filtered = append(filtered, schedule)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilterSchedules(t *testing.T) {
+	schedules := []nervecentre.Schedule{
+		{
+			GroupId:     "G1",
+			ParameterId: "P1",
+			GroupName:   "Core",
+		},
+		{
+			GroupId:     "G2",
+			ParameterId: "P2",
+			GroupName:   "Platform",
+		},
+	}
+	tests := []struct {
+		name  string
+		group string
+		want  []nervecentre.Schedule
+	}{
+		{
+			name:  "No filter",
+			group: "",
+			want:  schedules,
+		},
+		{
+			name:  "By group id",
+			group: "G2",
+			want:  []nervecentre.Schedule{schedules[1]},
+		},
+		{
+			name:  "By group name",
+			group: "core",
+			want:  []nervecentre.Schedule{schedules[0]},
+		},
+		{
+			name:  "Unknown group",
+			group: "G3",
+			want:  []nervecentre.Schedule{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterSchedules(schedules, tt.group); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterSchedules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildOverview(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{
+			UserId: "1",
+			Name:   "Alice",
+		},
+		{
+			UserId: "2",
+			Name:   "Bob",
+		},
+	}
+	days := map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"1"},
+		"2021-01-03": {"2"},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		date := path.Base(r.URL.Path)
+		start, _ := time.Parse("2006-01-02", date)
+		planning := nervecentre.Planning{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:   start,
+					End:     start.Add(24 * time.Hour),
+					Members: days[date],
+				},
+			},
+		}
+		body, _ := json.Marshal(planning)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer ts.Close()
+	client := nervecentre.NewClient(nervecentre.WithBaseUrl(ts.URL), nervecentre.WithTimezone(loc))
+
+	got, err := BuildOverview(context.Background(), client, nervecentre.Schedule{GroupId: "G1", ParameterId: "P1"}, users, time.Date(2021, 1, 1, 12, 0, 0, 0, loc), Days(90), 4)
+
+	if err != nil {
+		t.Fatalf("BuildOverview() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Current, []string{"Alice"}) {
+		t.Errorf("BuildOverview() Current = %v, want %v", got.Current, []string{"Alice"})
+	}
+
+	if want := time.Date(2021, 1, 3, 0, 0, 0, 0, loc); !got.CurrentEnd.Equal(want) {
+		t.Errorf("BuildOverview() CurrentEnd = %v, want %v", got.CurrentEnd, want)
+	}
+
+	if got.Next == nil || !reflect.DeepEqual(got.NextMembers, []string{"Bob"}) {
+		t.Errorf("BuildOverview() NextMembers = %v, want %v", got.NextMembers, []string{"Bob"})
+	}
+
+	if want := time.Date(2021, 1, 4, 0, 0, 0, 0, loc); !got.RosterEnd.Equal(want) {
+		t.Errorf("BuildOverview() RosterEnd = %v, want %v", got.RosterEnd, want)
+	}
+
+	if got.HorizonReached {
+		t.Errorf("BuildOverview() HorizonReached = %v, want %v", got.HorizonReached, false)
+	}
+
+	wantShifts := []Shift{
+		{Start: time.Date(2021, 1, 1, 0, 0, 0, 0, loc), End: time.Date(2021, 1, 3, 0, 0, 0, 0, loc), Members: []string{"Alice"}},
+		{Start: time.Date(2021, 1, 3, 0, 0, 0, 0, loc), End: time.Date(2021, 1, 4, 0, 0, 0, 0, loc), Members: []string{"Bob"}},
+	}
+
+	if len(got.Shifts) != len(wantShifts) {
+		t.Fatalf("BuildOverview() Shifts = %v, want %v", got.Shifts, wantShifts)
+	}
+
+	for i, shift := range got.Shifts {
+		if !shift.Start.Equal(wantShifts[i].Start) || !shift.End.Equal(wantShifts[i].End) || !Equal(shift.Members, wantShifts[i].Members) {
+			t.Errorf("BuildOverview() Shifts[%d] = %v, want %v", i, shift, wantShifts[i])
+		}
+	}
+
+	if len(got.Sections("")) != 3 {
+		t.Errorf("Sections() = %v, want 3 sections", got.Sections(""))
+	}
+
+	got, err = BuildOverview(context.Background(), client, nervecentre.Schedule{GroupId: "G1", ParameterId: "P1"}, users, time.Date(2021, 1, 1, 12, 0, 0, 0, loc), Days(2), 4)
+
+	if err != nil {
+		t.Fatalf("BuildOverview() error = %v", err)
+	}
+
+	if want := time.Date(2021, 1, 3, 0, 0, 0, 0, loc); !got.HorizonReached || !got.RosterEnd.Equal(want) {
+		t.Errorf("BuildOverview() RosterEnd = %v, HorizonReached = %v, want %v, %v", got.RosterEnd, got.HorizonReached, want, true)
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// assertGolden compares got with the golden file testdata/name, or writes it when the tests run with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(golden)
+
+	if err != nil {
+		t.Fatalf("could not read golden file, run the tests with -update to create it: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// newTestOverviews returns the overview of Core, where Alice is on call and Bob is next, and of Platform, where
+// nobody is on call.
+func newTestOverviews() (*Overview, *Overview) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{
+			UserId: "1",
+			Name:   "Alice",
+		},
+		{
+			UserId: "2",
+			Name:   "Bob",
+		},
+	}
+	runTime := time.Date(2021, 1, 1, 12, 0, 0, 0, loc)
+	planning := func(day int, members ...string) *nervecentre.Planning {
+		return &nervecentre.Planning{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:   time.Date(2021, 1, day, 0, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, day+1, 0, 0, 0, 0, loc),
+					Members: members,
+				},
+			},
+		}
+	}
+
+	core := NewOverview(nervecentre.Schedule{GroupName: "Core"}, users, []*nervecentre.Planning{planning(1, "1"), planning(2, "2")}, runTime)
+	platform := NewOverview(nervecentre.Schedule{GroupName: "Platform"}, users, []*nervecentre.Planning{planning(1)}, runTime)
+
+	return core, platform
+}
+
+func TestSlackNotifier_OverviewPayload(t *testing.T) {
+	core, platform := newTestOverviews()
+
+	tests := []struct {
+		name      string
+		overviews []*Overview
+		format    string
+	}{
+		{
+			name:      "overview-attachments.json",
+			overviews: []*Overview{core},
+			format:    FormatAttachments,
+		},
+		{
+			name:      "overview-blocks.json",
+			overviews: []*Overview{core},
+			format:    FormatBlocks,
+		},
+		{
+			name:      "combined-attachments.json",
+			overviews: []*Overview{core, platform},
+			format:    FormatAttachments,
+		},
+		{
+			name:      "combined-blocks.json",
+			overviews: []*Overview{core, platform},
+			format:    FormatBlocks,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &SlackNotifier{Format: tt.format, Mentions: map[string]string{"Bob": "<@U2>"}}
+			got, err := json.MarshalIndent(notifier.overviewPayload(tt.overviews), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.name, append(got, '\n'))
+		})
+	}
+}
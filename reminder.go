@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"time"
+)
+
+// Reminder announces a wachtdienst to the members that are about to go on call.
+type Reminder struct {
+	Schedule nervecentre.Schedule
+	Location *time.Location
+	Start    time.Time
+	End      time.Time
+	Members  []string
+	Backup   []string
+	// Previous are the members the incoming members take over from
+	Previous []string
+}
+
+// DueReminders returns a reminder for every slot in plannings whose members differ from the slot before it, that has
+// not started yet at runTime, of which the reminder time has passed and whose start was not announced before.
+// Consecutive slots with the same members are one wachtdienst, so its members are only reminded once.
+func DueReminders(schedule nervecentre.Schedule, users []nervecentre.Member, plannings []*nervecentre.Planning, runTime time.Time, reminder ReminderConfig, announced []time.Time) []Reminder {
+	reminders := make([]Reminder, 0)
+	slots := nervecentre.MergePlannings(plannings).EffectiveTimeSlots()
+
+	var previous []string
+	var current *Reminder
+
+	for _, slot := range slots {
+		members := slot.GetMembers(users)
+
+		if len(members) > 0 && Equal(members, previous) && current != nil && current.End.Equal(slot.Start) {
+			current.End = slot.End
+			continue
+		}
+
+		if len(members) > 0 && !Equal(members, previous) && slot.Start.After(runTime) &&
+			!reminder.RemindAt(slot.Start).After(runTime) && !isAnnounced(announced, slot.Start) {
+			reminders = append(reminders, Reminder{
+				Schedule: schedule,
+				Location: runTime.Location(),
+				Start:    slot.Start,
+				End:      slot.End,
+				Members:  members,
+				Backup:   slot.GetBackupMembers(users),
+				Previous: previous,
+			})
+			current = &reminders[len(reminders)-1]
+		} else {
+			current = nil
+		}
+
+		previous = members
+	}
+
+	return reminders
+}
+
+func isAnnounced(announced []time.Time, start time.Time) bool {
+	for _, announcedStart := range announced {
+		if announcedStart.Equal(start) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Message returns the message reminding the members of their wachtdienst.
+func (reminder *Reminder) Message() *Message {
+	return &Message{
+		Icon:     "⏰",
+		Schedule: reminder.Schedule,
+		Title:    "Herinnering",
+		Text: Text{
+			{Text: "Herinnering: "},
+			{Members: reminder.Members},
+			{Text: ", de wachtdienst " + reminder.Schedule.GroupName + " begint op " + reminder.format(reminder.Start, "02-01-2006 om 15:04")},
+		},
+		Sections: []Section{
+			{
+				Title: "Wachtdienst",
+				Text: Text{
+					{Members: reminder.Members},
+					{Text: " van " + reminder.format(reminder.Start, "02-01-2006 15:04") + " tot " + reminder.format(reminder.End, "02-01-2006 15:04") + backupString(reminder.Backup)},
+				},
+				Severity: SeverityWarning,
+			},
+			{
+				Title:    "Neemt over van",
+				Text:     NewText(membersString(reminder.Previous)),
+				Severity: SeverityGood,
+			},
+		},
+	}
+}
+
+func (reminder *Reminder) format(time time.Time, layout string) string {
+	return time.In(reminder.Location).Format(layout)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"testing"
+	"time"
+)
+
+func TestDueReminders(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	users := []nervecentre.Member{
+		{
+			UserId: "1",
+			Name:   "Alice",
+		},
+		{
+			UserId: "2",
+			Name:   "Bob",
+		},
+	}
+	plannings := []*nervecentre.Planning{
+		{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:   time.Date(2021, 1, 1, 0, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, 1, 17, 0, 0, 0, loc),
+					Members: []string{"1"},
+				},
+				{
+					Start:   time.Date(2021, 1, 1, 17, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+					Members: []string{"2"},
+				},
+			},
+		},
+		{
+			BaseTimeSlots: []nervecentre.Slot{
+				{
+					Start:   time.Date(2021, 1, 2, 0, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, 2, 8, 0, 0, 0, loc),
+					Members: []string{"2"},
+				},
+				{
+					Start:   time.Date(2021, 1, 2, 8, 0, 0, 0, loc),
+					End:     time.Date(2021, 1, 3, 0, 0, 0, 0, loc),
+					Members: []string{"1"},
+				},
+			},
+		},
+	}
+	lead := ReminderConfig{Lead: Duration(2 * time.Hour)}
+	tests := []struct {
+		name       string
+		runTime    time.Time
+		reminder   ReminderConfig
+		announced  []time.Time
+		wantStarts []time.Time
+		wantEnd    time.Time
+		wantFrom   []string
+	}{
+		{
+			name:       "Too early",
+			runTime:    time.Date(2021, 1, 1, 14, 59, 0, 0, loc),
+			reminder:   lead,
+			wantStarts: nil,
+		},
+		{
+			name:       "Within lead time",
+			runTime:    time.Date(2021, 1, 1, 15, 0, 0, 0, loc),
+			reminder:   lead,
+			wantStarts: []time.Time{time.Date(2021, 1, 1, 17, 0, 0, 0, loc)},
+			wantEnd:    time.Date(2021, 1, 2, 8, 0, 0, 0, loc),
+			wantFrom:   []string{"Alice"},
+		},
+		{
+			name:       "Already announced",
+			runTime:    time.Date(2021, 1, 1, 16, 0, 0, 0, loc),
+			reminder:   lead,
+			announced:  []time.Time{time.Date(2021, 1, 1, 17, 0, 0, 0, loc)},
+			wantStarts: nil,
+		},
+		{
+			name:       "Continuation of the same wachtdienst",
+			runTime:    time.Date(2021, 1, 1, 23, 0, 0, 0, loc),
+			reminder:   lead,
+			wantStarts: nil,
+		},
+		{
+			name:       "Evening before",
+			runTime:    time.Date(2021, 1, 1, 19, 0, 0, 0, loc),
+			reminder:   ReminderConfig{At: "19:00"},
+			wantStarts: []time.Time{time.Date(2021, 1, 2, 8, 0, 0, 0, loc)},
+			wantEnd:    time.Date(2021, 1, 3, 0, 0, 0, 0, loc),
+			wantFrom:   []string{"Bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DueReminders(nervecentre.Schedule{GroupName: "Core"}, users, plannings, tt.runTime, tt.reminder, tt.announced)
+			if len(got) != len(tt.wantStarts) {
+				t.Fatalf("DueReminders() = %+v, want starts %v", got, tt.wantStarts)
+			}
+			for i, reminder := range got {
+				if !reminder.Start.Equal(tt.wantStarts[i]) || !reminder.End.Equal(tt.wantEnd) || !Equal(reminder.Previous, tt.wantFrom) {
+					t.Errorf("DueReminders()[%d] = %+v, want start %v, end %v, previous %v", i, reminder, tt.wantStarts[i], tt.wantEnd, tt.wantFrom)
+				}
+			}
+		})
+	}
+}
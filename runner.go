@@ -0,0 +1,760 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner executes the configured work for every tenant, reporting failures to the destinations of the tenant or
+// schedule that failed without stopping the other tenants.
+type Runner struct {
+	config            *Config
+	group             string
+	scheduleTimezones ScheduleTimezones
+	logger            *log.Logger
+	verbose           bool
+	redactor          *Redactor
+	failed            bool
+	// clients keeps the logged in client of every namespace, so a long-lived runner reuses the session
+	clients    map[string]*nervecentre.Client
+	slackApi   *SlackApi
+	slackUsers *SlackUsers
+	// mutex lets a single task or export use the runner at a time, as the HTTP server exports while jobs run
+	mutex sync.Mutex
+}
+
+const (
+	TaskOverview  = "overview"
+	TaskHandover  = "handover"
+	TaskChanges   = "changes"
+	TaskCoverage  = "coverage"
+	TaskReminder  = "reminder"
+	TaskUsergroup = "usergroup"
+	TaskTopic     = "topic"
+)
+
+// Tasks are the tasks a job can run.
+var Tasks = []string{TaskOverview, TaskHandover, TaskChanges, TaskCoverage, TaskReminder, TaskUsergroup, TaskTopic}
+
+func IsTask(task string) bool {
+	for _, known := range Tasks {
+		if task == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Target is a schedule of Nerve Centre together with the destinations it posts to.
+type Target struct {
+	Tenant   TenantConfig
+	Schedule nervecentre.Schedule
+	// Config is the configuration of the schedule, it is empty when the tenant configures no schedules
+	Config       ScheduleConfig
+	Destinations []string
+}
+
+func NewRunner(config *Config, group string, scheduleTimezones ScheduleTimezones, logger *log.Logger, verbose bool) *Runner {
+	runner := &Runner{
+		config:            config,
+		group:             group,
+		scheduleTimezones: scheduleTimezones,
+		logger:            logger,
+		verbose:           verbose,
+		redactor:          newRedactor(config),
+		clients:           make(map[string]*nervecentre.Client),
+	}
+	runner.slackApi = NewSlackApi(config.Slack.Token)
+	runner.slackUsers = NewSlackUsers(config.Slack, runner.slackApi)
+
+	return runner
+}
+
+func newRedactor(config *Config) *Redactor {
+	redactor := &Redactor{}
+
+	for _, destination := range config.Destinations {
+		redactor.Add(destination.Webhook)
+		redactor.Add(destination.Email.Password)
+		redactor.Add(destination.Request.Secret)
+	}
+
+	for _, tenant := range config.Tenants {
+		redactor.Add(tenant.Password)
+	}
+
+	redactor.Add(config.Slack.Token)
+	redactor.Add(config.Http.Token)
+
+	return redactor
+}
+
+func (runner *Runner) logf(format string, args ...interface{}) {
+	runner.logger.Print(runner.redactor.Redact(fmt.Sprintf(format, args...)))
+}
+
+// mentions returns the Slack mentions of the users with one of names, a failure to look them up is logged and the
+// members are shown by name.
+func (runner *Runner) mentions(ctx context.Context, users []nervecentre.Member, names ...[]string) map[string]string {
+	mentions, err := runner.slackUsers.Mentions(ctx, shownMembers(users, names...))
+
+	if err != nil {
+		runner.logf("Could not look up all Slack users: %v", err)
+	}
+
+	return mentions
+}
+
+func (runner *Runner) Failed() bool {
+	return runner.failed
+}
+
+func (runner *Runner) client(tenant TenantConfig) (*nervecentre.Client, error) {
+	location, err := runner.config.Location(tenant, ScheduleConfig{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	options := []nervecentre.Option{
+		nervecentre.WithNamespace(tenant.Namespace),
+		nervecentre.WithTimezone(location),
+	}
+
+	if tenant.BaseUrl != "" {
+		options = append(options, nervecentre.WithBaseUrl(tenant.BaseUrl))
+	}
+
+	if runner.verbose {
+		options = append(options, nervecentre.WithLogger(runner.logger))
+	}
+
+	for _, schedule := range tenant.Schedules {
+		if schedule.Timezone == "" {
+			continue
+		}
+
+		scheduleLocation, err := runner.config.Location(tenant, schedule)
+
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, nervecentre.WithScheduleTimezone(schedule.Group, scheduleLocation))
+	}
+
+	for group, scheduleLocation := range runner.scheduleTimezones {
+		options = append(options, nervecentre.WithScheduleTimezone(group, scheduleLocation))
+	}
+
+	return nervecentre.NewClient(options...), nil
+}
+
+// login returns a client for tenant with a session and resolves the targets of the tenant. The client is created and
+// logged in on first use only, it logs in again by itself when the session expires.
+func (runner *Runner) login(ctx context.Context, tenant TenantConfig) (*nervecentre.Client, []Target, error) {
+	client, ok := runner.clients[tenant.Namespace]
+
+	if !ok {
+		var err error
+
+		if client, err = runner.client(tenant); err != nil {
+			return nil, nil, err
+		}
+
+		password, err := tenant.ResolvePassword()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		runner.redactor.Add(password)
+
+		if err := client.LoginContext(ctx, tenant.Username, password); err != nil {
+			return nil, nil, err
+		}
+
+		runner.clients[tenant.Namespace] = client
+	}
+
+	targets, err := runner.targets(ctx, client, tenant)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, targets, nil
+}
+
+func (runner *Runner) targets(ctx context.Context, client *nervecentre.Client, tenant TenantConfig) ([]Target, error) {
+	schedules, err := client.GetSchedulesContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schedules = FilterSchedules(schedules, runner.group)
+
+	if len(schedules) == 0 && runner.group != "" {
+		return nil, fmt.Errorf("no schedule found for group %q", runner.group)
+	}
+
+	if len(schedules) == 0 {
+		return nil, errors.New("Nerve Centre returned no schedules")
+	}
+
+	targets := make([]Target, 0, len(schedules))
+
+	if len(tenant.Schedules) == 0 {
+		for _, schedule := range schedules {
+			targets = append(targets, Target{Tenant: tenant, Schedule: schedule, Destinations: tenant.Destinations})
+		}
+
+		return targets, nil
+	}
+
+	for _, scheduleConfig := range tenant.Schedules {
+		for _, schedule := range FilterSchedules(schedules, scheduleConfig.Group) {
+			targets = append(targets, Target{Tenant: tenant, Schedule: schedule, Config: scheduleConfig, Destinations: tenant.DestinationsFor(scheduleConfig)})
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("none of the configured schedules were returned by Nerve Centre")
+	}
+
+	return targets, nil
+}
+
+// Run executes task, one of Tasks, with runTime as the current time.
+func (runner *Runner) Run(ctx context.Context, task string, runTime time.Time) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	switch task {
+	case TaskOverview:
+		runner.RunOverview(ctx, runTime)
+	case TaskHandover:
+		runner.RunHandover(ctx, runTime)
+	case TaskChanges:
+		runner.RunChanges(ctx, runTime)
+	case TaskCoverage:
+		runner.RunCoverage(ctx, runTime)
+	case TaskReminder:
+		runner.RunReminders(ctx, runTime)
+	case TaskUsergroup:
+		runner.RunUsergroups(ctx, runTime)
+	case TaskTopic:
+		runner.RunTopics(ctx, runTime)
+	default:
+		runner.failed = true
+		runner.logf("Unknown task %q", task)
+	}
+}
+
+// eachTarget calls fn for every target of every tenant. Failures to log in or of fn are reported to the destinations
+// they concern, the other targets continue.
+func (runner *Runner) eachTarget(ctx context.Context, fn func(client *nervecentre.Client, target Target) error) {
+	for _, tenant := range runner.config.Tenants {
+		client, targets, err := runner.login(ctx, tenant)
+
+		if err != nil {
+			runner.sendFailureToSlack(tenant.AllDestinations(), nervecentre.Schedule{}, err)
+			continue
+		}
+
+		for _, target := range targets {
+			if err := fn(client, target); err != nil {
+				runner.sendFailureToSlack(target.Destinations, target.Schedule, err)
+			}
+		}
+	}
+}
+
+// RunOverview posts an overview of every schedule, or one combined overview per destination. Destinations that post
+// with the Slack Web API update the overview of the same day instead of posting another one.
+func (runner *Runner) RunOverview(ctx context.Context, runTime time.Time) {
+	combined := make(map[string][]*Overview)
+	combinedMentions := make(map[string]map[string]string)
+	order := make([]string, 0, len(runner.config.Destinations))
+
+	var state *State
+
+	if runner.usesApi() {
+		state = runner.loadState()
+	}
+
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		overview, err := BuildOverview(ctx, client, target.Schedule, users, runTime, runner.config.Horizon, runner.config.Concurrency)
+
+		if err != nil {
+			return err
+		}
+
+		mentions := runner.mentions(ctx, users, overview.Current, overview.NextMembers)
+
+		for _, name := range target.Destinations {
+			if runner.config.Combine {
+				if _, ok := combined[name]; !ok {
+					order = append(order, name)
+					combinedMentions[name] = make(map[string]string)
+				}
+
+				combined[name] = append(combined[name], overview)
+
+				for member, mention := range mentions {
+					combinedMentions[name][member] = mention
+				}
+
+				continue
+			}
+
+			runner.sendOverview(ctx, state, name, stateKey(target), []*Overview{overview}, mentions, runTime)
+		}
+
+		return nil
+	})
+
+	for _, name := range order {
+		runner.sendOverview(ctx, state, name, "combined", combined[name], combinedMentions[name], runTime)
+	}
+
+	if state != nil {
+		runner.saveState(state)
+	}
+}
+
+// sendOverview sends the overviews to destination name. A Slack destination that posts with the Web API updates the
+// message it posted for key before, unless a new day started at NewMessageAt since, so its channel holds a single
+// overview a day. A Slack destination mentions the members in mentions.
+func (runner *Runner) sendOverview(ctx context.Context, state *State, name string, key string, overviews []*Overview, mentions map[string]string, runTime time.Time) {
+	destination := runner.config.Destinations[name]
+	notifier := runner.notifier(name)
+	slack, ok := notifier.(*SlackNotifier)
+
+	if ok {
+		slack.Mentions = mentions
+	}
+
+	if !ok || slack.Api == nil {
+		runner.report(name, notifier.Notify(ctx, overviews))
+		return
+	}
+
+	location, err := runner.config.Location(TenantConfig{}, ScheduleConfig{})
+
+	if err != nil {
+		location = runTime.Location()
+	}
+
+	key = name + "/" + key
+
+	var previous *MessageState
+
+	if message, ok := state.Messages[key]; ok && !message.Posted.Before(destination.MessageDay(runTime.In(location))) {
+		previous = &message
+	}
+
+	posted, err := slack.PostOverview(ctx, overviews, previous, runTime)
+
+	if err != nil {
+		runner.report(name, err)
+		return
+	}
+
+	state.Messages[key] = posted
+}
+
+// usesApi reports whether any destination posts with the Slack Web API.
+func (runner *Runner) usesApi() bool {
+	for _, destination := range runner.config.Destinations {
+		if destination.UsesApi() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunHandover posts a handover message when other members are on call than at the previous run. The members that
+// are on call are remembered per destination once the message was sent to it, so a failed message is only retried
+// for the destination it failed for.
+func (runner *Runner) RunHandover(ctx context.Context, runTime time.Time) {
+	state := runner.loadState()
+
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		location := client.Location(target.Schedule)
+		planning, err := client.GetPlanningContext(ctx, target.Schedule, runTime)
+
+		if err != nil {
+			return err
+		}
+
+		for _, name := range target.Destinations {
+			key := destinationKey(name, target)
+
+			var previous *HandoverState
+
+			if seen, ok := state.Handovers[key]; ok {
+				previous = &seen
+			}
+
+			handover := NewHandover(target.Schedule, users, planning, runTime.In(location), previous)
+
+			if handover.Changed() {
+				// The failure is reported, the handover is sent to this destination again at the next run
+				if err := runner.send(ctx, name, users, handover.Message()); err != nil {
+					continue
+				}
+			}
+
+			state.Handovers[key] = handover.State(runTime)
+		}
+
+		return nil
+	})
+
+	runner.saveState(state)
+}
+
+// RunChanges posts the changes made to the roster within the horizon since the previous run. The first run only takes
+// a snapshot. Like handovers, the snapshot of a destination is only replaced once the changes were sent to it.
+func (runner *Runner) RunChanges(ctx context.Context, runTime time.Time) {
+	state := runner.loadState()
+
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		location := client.Location(target.Schedule)
+		// Every day is compared, also those after a day without members
+		plannings, err := client.GetPlanningDays(ctx, target.Schedule, runTime, int(runner.config.Horizon), runner.config.Concurrency)
+
+		if err != nil {
+			return err
+		}
+
+		snapshot := NewSnapshot(plannings, runTime.In(location))
+
+		for _, name := range target.Destinations {
+			key := destinationKey(name, target)
+
+			if previous, ok := state.Snapshots[key]; ok {
+				changes := &RosterChanges{
+					Schedule: target.Schedule,
+					Location: location,
+					Users:    users,
+					Changes:  DiffSnapshots(previous, snapshot),
+				}
+
+				if len(changes.Changes) > 0 {
+					// The failure is reported, the changes are sent to this destination again at the next run
+					if err := runner.send(ctx, name, users, changes.Message()); err != nil {
+						continue
+					}
+				}
+			}
+
+			state.Snapshots[key] = snapshot
+		}
+
+		return nil
+	})
+
+	runner.saveState(state)
+}
+
+// RunCoverage posts a warning for every schedule with coverage gaps within the horizon.
+func (runner *Runner) RunCoverage(ctx context.Context, runTime time.Time) {
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		// A day without members is a gap, so the days after it are fetched as well
+		plannings, err := client.GetPlanningDays(ctx, target.Schedule, runTime, int(runner.config.Horizon), runner.config.Concurrency)
+
+		if err != nil {
+			return err
+		}
+
+		coverage := NewCoverage(target.Schedule, users, plannings, runTime.In(client.Location(target.Schedule)))
+
+		if len(coverage.Gaps) == 0 {
+			return nil
+		}
+
+		for _, name := range target.Destinations {
+			runner.send(ctx, name, users, coverage.Message())
+		}
+
+		return nil
+	})
+}
+
+// RunReminders reminds the members that go on call of their wachtdienst. The starts of the slots announced to a
+// destination are remembered, so members are reminded once however often this runs.
+func (runner *Runner) RunReminders(ctx context.Context, runTime time.Time) {
+	state := runner.loadState()
+
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		location := client.Location(target.Schedule)
+		localRunTime := runTime.In(location)
+		start := time.Date(localRunTime.Year(), localRunTime.Month(), localRunTime.Day(), 0, 0, 0, 0, location)
+
+		// Fetch every day a slot can start on that is reminded of now
+		reach := localRunTime.Add(time.Duration(runner.config.Reminder.Lead))
+
+		if runner.config.Reminder.At != "" {
+			reach = start.AddDate(0, 0, 2)
+		}
+
+		days := int(reach.Sub(start)/(24*time.Hour)) + 1
+		plannings, err := client.GetPlannings(ctx, target.Schedule, runTime, days, runner.config.Concurrency)
+
+		if err != nil {
+			return err
+		}
+
+		for _, name := range target.Destinations {
+			key := destinationKey(name, target)
+			announced := make([]time.Time, 0, len(state.Reminders[key]))
+
+			// Slots that started no longer need to be remembered
+			for _, announcedStart := range state.Reminders[key] {
+				if announcedStart.After(runTime) {
+					announced = append(announced, announcedStart)
+				}
+			}
+
+			for _, reminder := range DueReminders(target.Schedule, users, plannings, localRunTime, runner.config.Reminder, announced) {
+				// A reminder that failed is sent to this destination again at the next run
+				if err := runner.send(ctx, name, users, reminder.Message()); err == nil {
+					announced = append(announced, reminder.Start)
+				}
+			}
+
+			state.Reminders[key] = announced
+		}
+
+		return nil
+	})
+
+	runner.saveState(state)
+}
+
+// RunUsergroups sets the members of the Slack user group of every schedule that has one to the Slack users of the
+// members on call. The user group is only updated when its members differ.
+func (runner *Runner) RunUsergroups(ctx context.Context, runTime time.Time) {
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		if target.Config.Usergroup == "" {
+			return nil
+		}
+
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		planning, err := client.GetPlanningContext(ctx, target.Schedule, runTime)
+
+		if err != nil {
+			return err
+		}
+
+		slackIds, missing, err := runner.slackIds(ctx, planning.GetActiveSlot(runTime).GetMemberList(users))
+
+		if err != nil {
+			return err
+		}
+
+		if len(missing) > 0 {
+			runner.logf("No Slack user for %s of %s, leaving them out of user group %s", strings.Join(missing, ", "), target.Schedule.GroupName, target.Config.Usergroup)
+		}
+
+		if len(slackIds) == 0 {
+			return fmt.Errorf("nobody with a Slack user is on call for %s, user group %s is left as it is", target.Schedule.GroupName, target.Config.Usergroup)
+		}
+
+		current, err := runner.slackApi.UsergroupUsers(ctx, target.Config.Usergroup)
+
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(current)
+
+		if Equal(current, slackIds) {
+			return nil
+		}
+
+		runner.logf("Updating user group %s of %s to %s", target.Config.Usergroup, target.Schedule.GroupName, strings.Join(slackIds, ", "))
+
+		return runner.slackApi.UpdateUsergroupUsers(ctx, target.Config.Usergroup, slackIds)
+	})
+}
+
+// RunTopics sets the topic of the Slack channel of every schedule that has one to the members on call, only when the
+// topic is not already correct.
+func (runner *Runner) RunTopics(ctx context.Context, runTime time.Time) {
+	runner.eachTarget(ctx, func(client *nervecentre.Client, target Target) error {
+		topicConfig := target.Config.Topic
+
+		if topicConfig.Channel == "" {
+			return nil
+		}
+
+		users, err := client.GetMembersContext(ctx, target.Schedule)
+
+		if err != nil {
+			return err
+		}
+
+		overview, err := BuildOverview(ctx, client, target.Schedule, users, runTime, runner.config.Horizon, runner.config.Concurrency)
+
+		if err != nil {
+			return err
+		}
+
+		topic := topicConfig.Prefix + overview.Topic() + topicConfig.Suffix
+		current, err := runner.slackApi.ChannelTopic(ctx, topicConfig.Channel)
+
+		if err != nil {
+			return err
+		}
+
+		if current == topic {
+			return nil
+		}
+
+		runner.logf("Setting the topic of %s to %q", topicConfig.Channel, topic)
+
+		return runner.slackApi.SetChannelTopic(ctx, topicConfig.Channel, topic)
+	})
+}
+
+// slackIds returns the sorted Slack user ids of members, and the names of the members without a Slack user.
+func (runner *Runner) slackIds(ctx context.Context, members []nervecentre.Member) ([]string, []string, error) {
+	seen := make(map[string]bool)
+	ids := make([]string, 0, len(members))
+	missing := make([]string, 0)
+
+	for _, member := range members {
+		id, err := runner.slackUsers.Resolve(ctx, member)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if id == "" {
+			missing = append(missing, member.Name)
+			continue
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids, missing, nil
+}
+
+func (runner *Runner) loadState() *State {
+	state, err := LoadState(runner.config.State)
+
+	if err != nil {
+		runner.logf("%v", err)
+	}
+
+	return state
+}
+
+func (runner *Runner) saveState(state *State) {
+	if err := state.Save(runner.config.State); err != nil {
+		runner.failed = true
+		runner.logf("%v", err)
+	}
+}
+
+// notifier returns the notifier of destination name.
+func (runner *Runner) notifier(name string) Notifier {
+	return NewNotifier(runner.config.Destinations[name], runner.config.Format, runner.slackApi)
+}
+
+// send sends message to destination name, a Slack destination mentions the users named in it.
+func (runner *Runner) send(ctx context.Context, name string, users []nervecentre.Member, message *Message) error {
+	notifier := runner.notifier(name)
+
+	if slack, ok := notifier.(*SlackNotifier); ok {
+		slack.Mentions = runner.mentions(ctx, users, message.Names())
+	}
+
+	err := notifier.Send(ctx, message)
+	runner.report(name, err)
+
+	return err
+}
+
+// report marks the run as failed and logs err when sending to destination name failed.
+func (runner *Runner) report(name string, err error) {
+	if err != nil {
+		runner.failed = true
+		runner.logf("Could not send to destination %s: %v", name, err)
+	}
+}
+
+func (runner *Runner) sendFailureToSlack(destinations []string, schedule nervecentre.Schedule, err error) {
+	runner.failed = true
+
+	if errors.Is(err, context.Canceled) {
+		runner.logf("Stopped before all wachtdiensten were sent: %v", err)
+		return
+	}
+
+	runner.logf("Kon wachtdiensten niet ophalen uit Nerve Centre: %v", err)
+
+	// The context of the run is likely done already, so the failure is sent with a context of its own
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range destinations {
+		if sendErr := runner.notifier(name).NotifyFailure(ctx, schedule, runner.redactor.Redact(err.Error())); sendErr != nil {
+			runner.logf("Could not send failure to destination %s: %v", name, sendErr)
+		}
+	}
+}
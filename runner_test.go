@@ -0,0 +1,400 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newNerveCentre starts a fake Nerve Centre with the schedule Core, of which every day in days is a single slot with
+// the given member ids.
+func newNerveCentre(t *testing.T, users []nervecentre.Member, days map[string][]string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The tenant of newTestConfig has namespace acme
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/acme")
+
+		switch {
+		case r.URL.Path == "/reachability/controller/1.0/groups/config/schedules":
+			w.Write([]byte(`[{"groupId": "G1", "parameterId": "P1", "groupName": "Core"}]`))
+		case r.URL.Path == "/um/controller/1.0/groups/G1":
+			body, _ := json.Marshal(map[string]interface{}{"members": users})
+			w.Write(body)
+		case strings.HasPrefix(r.URL.Path, "/reachability/controller/1.0/groups/G1/config/P1/schedule/"):
+			date := path.Base(r.URL.Path)
+			start, _ := time.Parse("2006-01-02", date)
+			body, _ := json.Marshal(nervecentre.Planning{
+				BaseTimeSlots: []nervecentre.Slot{
+					{
+						Start:   start,
+						End:     start.Add(24 * time.Hour),
+						Members: days[date],
+					},
+				},
+			})
+			w.Write(body)
+		case r.URL.Path == "/vui/controller/1.0/login":
+			w.Header().Set("Location", ts.URL+"/login?ReturnUrl=~%2f&State=1234567890")
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.Header().Set("Location", ts.URL+"/login.cshtml")
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func newTestConfig(nerveCentreUrl string, webhook string) *Config {
+	config := NewConfig()
+	config.Tenants = []TenantConfig{
+		{
+			Namespace: "acme",
+			BaseUrl:   nerveCentreUrl,
+			Username:  "bot",
+			Password:  "secret",
+			Schedules: []ScheduleConfig{
+				{
+					Group:        "Core",
+					Destinations: []string{"ops"},
+				},
+			},
+		},
+	}
+	config.Destinations["ops"] = DestinationConfig{Webhook: webhook}
+
+	return config
+}
+
+func TestRunner_RunUsergroups(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"2", "1"},
+	})
+
+	usergroup := []string{"U1"}
+	updates := 0
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/usergroups.users.list":
+			body, _ := json.Marshal(map[string]interface{}{"ok": true, "users": usergroup})
+			w.Write(body)
+		case "/usergroups.users.update":
+			updates++
+			usergroup = strings.Split(r.FormValue("users"), ",")
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		}
+	}))
+	defer slack.Close()
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Tenants[0].Schedules[0].Usergroup = "S1"
+	config.Slack = SlackConfig{Token: "xoxb-test", Users: map[string]string{"1": "U1", "Bob": "U2"}}
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+	runner.slackApi.baseUrl = slack.URL
+
+	for run := 0; run < 2; run++ {
+		runner.RunUsergroups(context.Background(), time.Date(2021, 1, 1, 12, 0, 0, 0, loc))
+	}
+
+	if runner.Failed() {
+		t.Errorf("RunUsergroups() failed")
+	}
+
+	if updates != 1 || !Equal(usergroup, []string{"U1", "U2"}) {
+		t.Errorf("RunUsergroups() updated %d times to %v, want once to [U1 U2]", updates, usergroup)
+	}
+}
+
+func TestRunner_RunTopics(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"1"},
+		"2021-01-03": {"2"},
+	})
+
+	topic := "Incidents &amp; storingen | Wachtdienst: Bob tot 01-01 08:00"
+	updates := 0
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/conversations.info":
+			body, _ := json.Marshal(map[string]interface{}{"ok": true, "channel": map[string]interface{}{"topic": map[string]string{"value": topic}}})
+			w.Write(body)
+		case "/conversations.setTopic":
+			updates++
+			topic = strings.ReplaceAll(r.FormValue("topic"), "&", "&amp;")
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		}
+	}))
+	defer slack.Close()
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Tenants[0].Schedules[0].Topic = TopicConfig{Channel: "C1", Prefix: "Incidents & storingen | "}
+	config.Slack = SlackConfig{Token: "xoxb-test"}
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+	runner.slackApi.baseUrl = slack.URL
+
+	for run := 0; run < 2; run++ {
+		runner.RunTopics(context.Background(), time.Date(2021, 1, 1, 12, 0, 0, 0, loc))
+	}
+
+	if runner.Failed() {
+		t.Errorf("RunTopics() failed")
+	}
+
+	if want := "Incidents &amp; storingen | Wachtdienst: Alice tot 03-01 00:00"; updates != 1 || topic != want {
+		t.Errorf("RunTopics() updated %d times to %q, want once to %q", updates, topic, want)
+	}
+}
+
+func TestRunner_RunOverview_Api(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}}, map[string][]string{
+		"2021-01-01": {"1"},
+	})
+
+	var calls []string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			calls = append(calls, fmt.Sprintf("post %v", message["channel"]))
+			body, _ := json.Marshal(map[string]interface{}{"ok": true, "channel": "C1", "ts": fmt.Sprintf("1609459200.%06d", len(calls))})
+			w.Write(body)
+		case "/chat.update":
+			calls = append(calls, fmt.Sprintf("update %v %v", message["channel"], message["ts"]))
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		}
+	}))
+	defer slack.Close()
+
+	config := newTestConfig(nerveCentre.URL, "")
+	config.Destinations["ops"] = DestinationConfig{Sender: SenderApi, Channel: "#ops", NewMessageAt: "08:00"}
+	config.Slack = SlackConfig{Token: "xoxb-test"}
+	config.State = filepath.Join(t.TempDir(), "state.json")
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+	runner.slackApi.baseUrl = slack.URL
+
+	for _, runTime := range []time.Time{
+		time.Date(2021, 1, 1, 9, 0, 0, 0, loc),
+		time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+		time.Date(2021, 1, 2, 7, 0, 0, 0, loc),
+		time.Date(2021, 1, 2, 9, 0, 0, 0, loc),
+	} {
+		runner.RunOverview(context.Background(), runTime)
+	}
+
+	if runner.Failed() {
+		t.Errorf("RunOverview() failed")
+	}
+
+	want := []string{
+		"post #ops",
+		"update C1 1609459200.000001",
+		"update C1 1609459200.000001",
+		"post #ops",
+	}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("RunOverview() called %v, want %v", calls, want)
+	}
+}
+
+func TestRunner_RunHandover_Mentions(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"2"},
+	})
+
+	// The messages are decoded so mentions are not escaped
+	messages := make(map[string]string)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		messages[r.URL.Path] = fmt.Sprint(message)
+	}))
+	defer webhook.Close()
+
+	config := newTestConfig(nerveCentre.URL, webhook.URL+"/slack")
+	config.Tenants[0].Schedules[0].Destinations = []string{"ops", "chat"}
+	config.Destinations["chat"] = DestinationConfig{Type: TypeTeams, Webhook: webhook.URL + "/teams"}
+	config.Slack = SlackConfig{Users: map[string]string{"2": "U2"}}
+	config.State = filepath.Join(t.TempDir(), "state.json")
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+
+	for _, runTime := range []time.Time{
+		time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+		time.Date(2021, 1, 2, 12, 0, 0, 0, loc),
+	} {
+		runner.RunHandover(context.Background(), runTime)
+	}
+
+	if runner.Failed() {
+		t.Errorf("RunHandover() failed")
+	}
+
+	if !strings.Contains(messages["/slack"], "Alice → <@U2>") {
+		t.Errorf("RunHandover() sent %s to Slack, want a mention of Bob", messages["/slack"])
+	}
+
+	if !strings.Contains(messages["/teams"], "Alice → Bob") || strings.Contains(messages["/teams"], "<@U2>") {
+		t.Errorf("RunHandover() sent %s to Teams, want Bob by name", messages["/teams"])
+	}
+}
+
+func TestRunner_RunHandover_FailingDestination(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"2"},
+	})
+
+	posts := make(map[string]int)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts[r.URL.Path]++
+
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer webhook.Close()
+
+	config := newTestConfig(nerveCentre.URL, webhook.URL+"/ops")
+	config.Tenants[0].Schedules[0].Destinations = []string{"broken", "ops"}
+	config.Destinations["broken"] = DestinationConfig{Webhook: webhook.URL + "/broken"}
+	config.State = filepath.Join(t.TempDir(), "state.json")
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+
+	for _, runTime := range []time.Time{
+		time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+		time.Date(2021, 1, 2, 12, 0, 0, 0, loc),
+		time.Date(2021, 1, 2, 12, 5, 0, 0, loc),
+	} {
+		runner.RunHandover(context.Background(), runTime)
+	}
+
+	if !runner.Failed() {
+		t.Errorf("RunHandover() did not fail")
+	}
+
+	// The handover is retried for the broken destination only
+	if want := map[string]int{"/broken": 2, "/ops": 1}; !reflect.DeepEqual(posts, want) {
+		t.Errorf("RunHandover() posted %v, want %v", posts, want)
+	}
+}
+
+func TestRunner_RunChanges_FailingDestination(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	days := map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"1"},
+	}
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, days)
+
+	posts := make(map[string]int)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts[r.URL.Path]++
+
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer webhook.Close()
+
+	config := newTestConfig(nerveCentre.URL, webhook.URL+"/ops")
+	config.Tenants[0].Schedules[0].Destinations = []string{"broken", "ops"}
+	config.Destinations["broken"] = DestinationConfig{Webhook: webhook.URL + "/broken"}
+	config.Horizon = 3
+	config.State = filepath.Join(t.TempDir(), "state.json")
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+	runner.RunChanges(context.Background(), time.Date(2021, 1, 1, 12, 0, 0, 0, loc))
+
+	days["2021-01-02"] = []string{"2"}
+
+	for _, runTime := range []time.Time{
+		time.Date(2021, 1, 1, 13, 0, 0, 0, loc),
+		time.Date(2021, 1, 1, 14, 0, 0, 0, loc),
+	} {
+		runner.RunChanges(context.Background(), runTime)
+	}
+
+	if !runner.Failed() {
+		t.Errorf("RunChanges() did not fail")
+	}
+
+	// The changes are retried for the broken destination only
+	if want := map[string]int{"/broken": 2, "/ops": 1}; !reflect.DeepEqual(posts, want) {
+		t.Errorf("RunChanges() posted %v, want %v", posts, want)
+	}
+}
+
+func TestRunner_RunReminders_FailingDestination(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	nerveCentre := newNerveCentre(t, []nervecentre.Member{{UserId: "1", Name: "Alice"}, {UserId: "2", Name: "Bob"}}, map[string][]string{
+		"2021-01-01": {"1"},
+		"2021-01-02": {"2"},
+	})
+
+	posts := make(map[string]int)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts[r.URL.Path]++
+
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer webhook.Close()
+
+	config := newTestConfig(nerveCentre.URL, webhook.URL+"/ops")
+	config.Tenants[0].Schedules[0].Destinations = []string{"broken", "ops"}
+	config.Destinations["broken"] = DestinationConfig{Webhook: webhook.URL + "/broken"}
+	config.Reminder = ReminderConfig{Lead: Duration(24 * time.Hour)}
+	config.State = filepath.Join(t.TempDir(), "state.json")
+
+	runner := NewRunner(config, "", ScheduleTimezones{}, log.New(ioutil.Discard, "", 0), false)
+
+	for _, runTime := range []time.Time{
+		time.Date(2021, 1, 1, 12, 0, 0, 0, loc),
+		time.Date(2021, 1, 1, 12, 10, 0, 0, loc),
+	} {
+		runner.RunReminders(context.Background(), runTime)
+	}
+
+	if !runner.Failed() {
+		t.Errorf("RunReminders() did not fail")
+	}
+
+	// The reminder of Bob is retried for the broken destination only
+	if want := map[string]int{"/broken": 2, "/ops": 1}; !reflect.DeepEqual(posts, want) {
+		t.Errorf("RunReminders() posted %v, want %v", posts, want)
+	}
+}
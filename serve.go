@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a task that runs on a cron schedule.
+type Job struct {
+	Cron     string
+	Task     string
+	schedule *CronSchedule
+}
+
+func NewJobs(configs []JobConfig) ([]Job, error) {
+	jobs := make([]Job, 0, len(configs))
+
+	for _, config := range configs {
+		schedule, err := ParseCron(config.Cron)
+
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, Job{Cron: config.Cron, Task: config.Task, schedule: schedule})
+	}
+
+	return jobs, nil
+}
+
+// nextRun returns the first time after now at which a job is due, together with every job that is due at that time.
+// A zero time is returned when no job will ever run.
+func nextRun(jobs []Job, now time.Time) (time.Time, []Job) {
+	var next time.Time
+	var due []Job
+
+	for _, job := range jobs {
+		at := job.schedule.Next(now)
+
+		switch {
+		case at.IsZero():
+		case next.IsZero() || at.Before(next):
+			next = at
+			due = []Job{job}
+		case at.Equal(next):
+			due = append(due, job)
+		}
+	}
+
+	return next, due
+}
+
+// Server runs jobs with a Runner until it is stopped, keeping the Nerve Centre sessions of the Runner in between.
+type Server struct {
+	runner   *Runner
+	jobs     []Job
+	location *time.Location
+	logger   *log.Logger
+	// deadline limits every single run of a job, there is no limit when it is zero
+	deadline time.Duration
+	// shutdownTimeout is how long a running job may continue after the server is stopped
+	shutdownTimeout time.Duration
+}
+
+func NewServer(runner *Runner, jobs []Job, location *time.Location, logger *log.Logger, deadline time.Duration, shutdownTimeout time.Duration) *Server {
+	return &Server{
+		runner:          runner,
+		jobs:            jobs,
+		location:        location,
+		logger:          logger,
+		deadline:        deadline,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+// Serve runs the jobs whenever they are due until ctx is done. Jobs that are due at the same time run one after the
+// other, in the order they are configured.
+func (server *Server) Serve(ctx context.Context) {
+	for {
+		next, due := nextRun(server.jobs, time.Now().In(server.location))
+
+		if next.IsZero() {
+			server.logger.Print("No job will run anymore, stopping")
+			return
+		}
+
+		server.logger.Printf("Next run at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			server.logger.Print("Stopping")
+			return
+		case <-timer.C:
+		}
+
+		for _, job := range due {
+			server.run(ctx, job, next)
+		}
+	}
+}
+
+// run executes job without stopping it as soon as ctx is done, it gets the shutdown timeout to finish first.
+func (server *Server) run(ctx context.Context, job Job, runTime time.Time) {
+	jobCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if server.deadline > 0 {
+		var cancelDeadline context.CancelFunc
+		jobCtx, cancelDeadline = context.WithTimeout(jobCtx, server.deadline)
+		defer cancelDeadline()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.logger.Printf("Waiting up to %s for %s to finish", server.shutdownTimeout, job.Task)
+		case <-done:
+			return
+		}
+
+		select {
+		case <-time.After(server.shutdownTimeout):
+			cancel()
+		case <-done:
+		}
+	}()
+
+	server.logger.Printf("Running %s (%s)", job.Task, job.Cron)
+	server.runner.Run(jobCtx, job.Task, runTime)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"4d63.com/tz"
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	loc, _ := tz.LoadLocation("Europe/Amsterdam")
+	jobs, err := NewJobs([]JobConfig{
+		{Cron: "30 8 * * *", Task: TaskOverview},
+		{Cron: "0 9 * * mon", Task: TaskOverview},
+		{Cron: "30 8 * * mon-fri", Task: TaskOverview},
+	})
+	if err != nil {
+		t.Fatalf("NewJobs() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		want     time.Time
+		wantJobs []string
+	}{
+		{
+			name:     "Weekday morning",
+			now:      time.Date(2021, 6, 7, 7, 0, 0, 0, loc),
+			want:     time.Date(2021, 6, 7, 8, 30, 0, 0, loc),
+			wantJobs: []string{"30 8 * * *", "30 8 * * mon-fri"},
+		},
+		{
+			name:     "Monday after the daily run",
+			now:      time.Date(2021, 6, 7, 8, 30, 0, 0, loc),
+			want:     time.Date(2021, 6, 7, 9, 0, 0, 0, loc),
+			wantJobs: []string{"0 9 * * mon"},
+		},
+		{
+			name:     "Saturday",
+			now:      time.Date(2021, 6, 12, 9, 0, 0, 0, loc),
+			want:     time.Date(2021, 6, 13, 8, 30, 0, 0, loc),
+			wantJobs: []string{"30 8 * * *"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, due := nextRun(jobs, tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextRun() = %v, want %v", got, tt.want)
+			}
+			var gotJobs []string
+			for _, job := range due {
+				gotJobs = append(gotJobs, job.Cron)
+			}
+			if !Equal(gotJobs, tt.wantJobs) {
+				t.Errorf("nextRun() jobs = %v, want %v", gotJobs, tt.wantJobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultSlackApiUrl = "https://slack.com/api/"
+
+// SlackApiError is returned when the Slack Web API answers with ok set to false, Code is the error of Slack, for
+// example users_not_found or missing_scope.
+type SlackApiError struct {
+	Method string
+	Code   string
+}
+
+func (err *SlackApiError) Error() string {
+	return fmt.Sprintf("slack %s failed: %s", err.Method, err.Code)
+}
+
+// ErrSlackUserNotFound is returned when Slack has no user for an email address.
+var ErrSlackUserNotFound = errors.New("no slack user found")
+
+// SlackApi calls the Slack Web API with a bot token.
+type SlackApi struct {
+	baseUrl    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewSlackApi(token string) *SlackApi {
+	return &SlackApi{
+		baseUrl:    DefaultSlackApiUrl,
+		token:      token,
+		httpClient: &slackHttpClient,
+	}
+}
+
+// call posts params to method and decodes the answer into target, which may be nil.
+func (api *SlackApi) call(ctx context.Context, method string, params url.Values, target interface{}) error {
+	return api.post(ctx, method, "application/x-www-form-urlencoded", []byte(params.Encode()), target)
+}
+
+// callJson posts payload to method as JSON, for methods with structured arguments like attachments and blocks.
+func (api *SlackApi) callJson(ctx context.Context, method string, payload interface{}, target interface{}) error {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return fmt.Errorf("could not encode slack %s: %w", method, err)
+	}
+
+	return api.post(ctx, method, "application/json; charset=utf-8", body, target)
+}
+
+func (api *SlackApi) post(ctx context.Context, method string, contentType string, payload []byte, target interface{}) error {
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(api.baseUrl, "/")+"/"+method, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+api.token)
+
+	resp, err := api.httpClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("could not call slack %s: %w", method, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return fmt.Errorf("could not call slack %s: %w", method, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not call slack %s, service returned %d", method, resp.StatusCode)
+	}
+
+	var result struct {
+		Ok    bool
+		Error string
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("could not decode slack %s: %w", method, err)
+	}
+
+	if !result.Ok {
+		return &SlackApiError{Method: method, Code: result.Error}
+	}
+
+	if target == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("could not decode slack %s: %w", method, err)
+	}
+
+	return nil
+}
+
+// LookupUserByEmail returns the id of the Slack user with email, or ErrSlackUserNotFound.
+func (api *SlackApi) LookupUserByEmail(ctx context.Context, email string) (string, error) {
+	var result struct {
+		User struct {
+			Id string
+		}
+	}
+
+	err := api.call(ctx, "users.lookupByEmail", url.Values{"email": {email}}, &result)
+
+	var apiError *SlackApiError
+
+	if errors.As(err, &apiError) && apiError.Code == "users_not_found" {
+		return "", ErrSlackUserNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return result.User.Id, nil
+}
+
+// UsergroupUsers returns the ids of the users in the Slack user group.
+func (api *SlackApi) UsergroupUsers(ctx context.Context, usergroup string) ([]string, error) {
+	var result struct {
+		Users []string
+	}
+
+	if err := api.call(ctx, "usergroups.users.list", url.Values{"usergroup": {usergroup}}, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Users, nil
+}
+
+// UpdateUsergroupUsers replaces the users of the Slack user group, Slack requires at least one user.
+func (api *SlackApi) UpdateUsergroupUsers(ctx context.Context, usergroup string, users []string) error {
+	return api.call(ctx, "usergroups.users.update", url.Values{"usergroup": {usergroup}, "users": {strings.Join(users, ",")}}, nil)
+}
+
+// ChannelTopic returns the topic of the Slack channel with entities like &amp; decoded.
+func (api *SlackApi) ChannelTopic(ctx context.Context, channel string) (string, error) {
+	var result struct {
+		Channel struct {
+			Topic struct {
+				Value string
+			}
+		}
+	}
+
+	if err := api.call(ctx, "conversations.info", url.Values{"channel": {channel}}, &result); err != nil {
+		return "", err
+	}
+
+	return html.UnescapeString(result.Channel.Topic.Value), nil
+}
+
+func (api *SlackApi) SetChannelTopic(ctx context.Context, channel string, topic string) error {
+	return api.call(ctx, "conversations.setTopic", url.Values{"channel": {channel}, "topic": {topic}}, nil)
+}
+
+// PostMessage posts message to its channel and returns the id of the channel and the timestamp of the message, which
+// together identify the message for UpdateMessage.
+func (api *SlackApi) PostMessage(ctx context.Context, message *SlackPayload) (string, string, error) {
+	var result struct {
+		Channel string
+		Ts      string
+	}
+
+	if err := api.callJson(ctx, "chat.postMessage", chatMessage(message.Channel, "", message), &result); err != nil {
+		return "", "", err
+	}
+
+	return result.Channel, result.Ts, nil
+}
+
+// UpdateMessage replaces the message with timestamp ts in channel by message, the channel of message is ignored.
+func (api *SlackApi) UpdateMessage(ctx context.Context, channel string, ts string, message *SlackPayload) error {
+	return api.callJson(ctx, "chat.update", chatMessage(channel, ts, message), nil)
+}
+
+// chatMessage returns the arguments of chat.postMessage, or of chat.update when ts is set. An update keeps the
+// attachments and blocks it leaves out, so they are cleared explicitly when the message has none.
+func chatMessage(channel string, ts string, message *SlackPayload) map[string]interface{} {
+	payload := map[string]interface{}{
+		"channel": channel,
+		"text":    message.Text,
+	}
+
+	if message.Username != "" {
+		payload["username"] = message.Username
+	}
+
+	if ts != "" {
+		payload["ts"] = ts
+		payload["attachments"] = []Attachment{}
+		payload["blocks"] = []Block{}
+	}
+
+	if len(message.Attachments) > 0 {
+		payload["attachments"] = message.Attachments
+	}
+
+	if len(message.Blocks) > 0 {
+		payload["blocks"] = message.Blocks
+	}
+
+	return payload
+}
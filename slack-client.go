@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -27,11 +28,56 @@ type Attachment struct {
 	Ts            json.Number `json:"ts,omitempty"`
 }
 
+// TextObject is the text of a Block Kit block, of type plain_text or mrkdwn.
+type TextObject struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// Block is a Block Kit layout block. Only the fields of its Type are set: Text for header and section, Fields for
+// section and Elements for context.
+type Block struct {
+	Type     string        `json:"type"`
+	Text     *TextObject   `json:"text,omitempty"`
+	Fields   []*TextObject `json:"fields,omitempty"`
+	Elements []*TextObject `json:"elements,omitempty"`
+}
+
+func PlainText(text string) *TextObject {
+	return &TextObject{Type: "plain_text", Text: text, Emoji: true}
+}
+
+func MarkdownText(text string) *TextObject {
+	return &TextObject{Type: "mrkdwn", Text: text}
+}
+
+func HeaderBlock(text string) Block {
+	return Block{Type: "header", Text: PlainText(text)}
+}
+
+// SectionBlock shows text, or fields in two columns, or both when both are given.
+func SectionBlock(text *TextObject, fields ...*TextObject) Block {
+	return Block{Type: "section", Text: text, Fields: fields}
+}
+
+// ContextBlock shows the elements in small print.
+func ContextBlock(elements ...*TextObject) Block {
+	return Block{Type: "context", Elements: elements}
+}
+
+func DividerBlock() Block {
+	return Block{Type: "divider"}
+}
+
+// SlackPayload is a message with legacy attachments or Block Kit blocks. Text is the notification of a message with
+// blocks.
 type SlackPayload struct {
 	Username    string       `json:"username,omitempty"`
 	Channel     string       `json:"channel,omitempty"`
 	Text        string       `json:"text,omitempty"`
 	Attachments []Attachment `json:"attachments,omitempty"`
+	Blocks      []Block      `json:"blocks,omitempty"`
 }
 
 var slackHttpClient http.Client
@@ -41,20 +87,30 @@ func init() {
 }
 
 func SendSlack(webhook string, payload *SlackPayload) error {
+	return SendSlackContext(context.Background(), webhook, payload)
+}
+
+func SendSlackContext(ctx context.Context, webhook string, payload *SlackPayload) error {
 	if len(webhook) == 0 {
 		return fmt.Errorf("no webhook url was provided")
 	}
 
 	body, _ := json.Marshal(payload)
 
-	req, _ := http.NewRequest("POST", webhook, bytes.NewBuffer(body))
+	req, _ := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, _ := slackHttpClient.Do(req)
+	resp, err := slackHttpClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("could not send slack notification: %w", err)
+	}
+
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("could not send slack notification, service returned %d", resp.StatusCode)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const DefaultStatePath = "nerve-centre-state.json"
+
+// StateVersion is the version of the state file format, state files of another version are ignored. Version 2 keeps
+// what was sent per destination.
+const StateVersion = 2
+
+// State is what is remembered between runs, for example who was on call at the last run.
+type State struct {
+	Version int `json:"version"`
+	// Handovers holds the members on call at the last handover sent to a destination, keyed by destinationKey
+	Handovers map[string]HandoverState `json:"handovers,omitempty"`
+	// Snapshots holds the planning last sent to a destination by the check for roster changes, keyed by destinationKey
+	Snapshots map[string]Snapshot `json:"snapshots,omitempty"`
+	// Reminders holds the starts of the slots that were announced to a destination, keyed by destinationKey
+	Reminders map[string][]time.Time `json:"reminders,omitempty"`
+	// Messages holds the overviews posted with the Slack Web API, keyed by destination and stateKey
+	Messages map[string]MessageState `json:"messages,omitempty"`
+}
+
+// MessageState identifies a message posted with the Slack Web API, so it can be updated.
+type MessageState struct {
+	Channel string    `json:"channel"`
+	Ts      string    `json:"ts"`
+	Posted  time.Time `json:"posted"`
+}
+
+type HandoverState struct {
+	Members []string  `json:"members"`
+	Seen    time.Time `json:"seen"`
+}
+
+// Snapshot is the planning of a schedule between From and To, including the days without members.
+type Snapshot struct {
+	From     time.Time             `json:"from"`
+	To       time.Time             `json:"to"`
+	Planning *nervecentre.Planning `json:"planning"`
+}
+
+func NewState() *State {
+	return &State{
+		Version:   StateVersion,
+		Handovers: make(map[string]HandoverState),
+		Snapshots: make(map[string]Snapshot),
+		Reminders: make(map[string][]time.Time),
+		Messages:  make(map[string]MessageState),
+	}
+}
+
+// LoadState reads the state file at path. A missing file results in an empty state. A file that cannot be read,
+// is corrupt or has another version also results in an empty state, together with an error explaining why, so the
+// caller can decide to continue without the previous state.
+func LoadState(path string) (*State, error) {
+	body, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return NewState(), nil
+	}
+
+	if err != nil {
+		return NewState(), fmt.Errorf("could not read state %s: %w", path, err)
+	}
+
+	state := NewState()
+
+	if err := json.Unmarshal(body, state); err != nil {
+		return NewState(), fmt.Errorf("could not parse state %s, starting with an empty state: %w", path, err)
+	}
+
+	if state.Version != StateVersion {
+		return NewState(), fmt.Errorf("state %s has version %d instead of %d, starting with an empty state", path, state.Version, StateVersion)
+	}
+
+	if state.Handovers == nil {
+		state.Handovers = make(map[string]HandoverState)
+	}
+
+	if state.Snapshots == nil {
+		state.Snapshots = make(map[string]Snapshot)
+	}
+
+	if state.Reminders == nil {
+		state.Reminders = make(map[string][]time.Time)
+	}
+
+	if state.Messages == nil {
+		state.Messages = make(map[string]MessageState)
+	}
+
+	return state, nil
+}
+
+// Save writes the state to path atomically, by writing a temporary file next to it and renaming it, so a crash never
+// leaves a half written state behind.
+func (state *State) Save(path string) error {
+	body, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+
+	if err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	return nil
+}
+
+// stateKey identifies a schedule in the state, group ids are only unique within a namespace.
+func stateKey(target Target) string {
+	return target.Tenant.Namespace + "/" + target.Schedule.GroupId
+}
+
+// destinationKey identifies a schedule and a destination it posts to in the state, for what is remembered per
+// destination so a failing destination does not make the others send the same message again.
+func destinationKey(name string, target Target) string {
+	return name + "/" + stateKey(target)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]HandoverState
+		wantErr bool
+	}{
+		{
+			name:    "Missing",
+			want:    map[string]HandoverState{},
+			wantErr: false,
+		},
+		{
+			name:    "Valid",
+			content: `{"version": 2, "handovers": {"ops/acme/G1": {"members": ["Alice"], "seen": "2021-01-01T08:00:00Z"}}}`,
+			want: map[string]HandoverState{
+				"ops/acme/G1": {Members: []string{"Alice"}, Seen: time.Date(2021, 1, 1, 8, 0, 0, 0, time.UTC)},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Corrupt",
+			content: `{"version": 2, "handovers": {"ops/acme/G1": {"mem`,
+			want:    map[string]HandoverState{},
+			wantErr: true,
+		},
+		{
+			name:    "Other version",
+			content: `{"version": 1, "handovers": {"acme/G1": {"members": ["Alice"]}}}`,
+			want:    map[string]HandoverState{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tt.content != "" {
+				ioutil.WriteFile(path, []byte(tt.content), 0600)
+			}
+			got, err := LoadState(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got == nil || !reflect.DeepEqual(got.Handovers, tt.want) {
+				t.Errorf("LoadState() = %+v, want handovers %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestState_Save(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := NewState()
+	state.Handovers["ops/acme/G1"] = HandoverState{Members: []string{"Alice", "Bob"}, Seen: time.Date(2021, 1, 1, 8, 0, 0, 0, time.UTC)}
+
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := LoadState(path)
+
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("LoadState() after Save() = %+v, want %+v", got, state)
+	}
+
+	if files, _ := filepath.Glob(path + ".*"); len(files) != 0 {
+		t.Errorf("Save() left temporary files %v", files)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+)
+
+// TeamsMessage is the payload of a Microsoft Teams incoming webhook, holding a single Adaptive Card.
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string        `json:"contentType"`
+	Content     *AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []CardElement     `json:"body"`
+	MsTeams map[string]string `json:"msteams,omitempty"`
+}
+
+// CardElement is an element of the body of an Adaptive Card. Only the fields of its Type are set: the text fields for
+// TextBlock, Style and Items for Container.
+type CardElement struct {
+	Type      string        `json:"type"`
+	Text      string        `json:"text,omitempty"`
+	Size      string        `json:"size,omitempty"`
+	Weight    string        `json:"weight,omitempty"`
+	Color     string        `json:"color,omitempty"`
+	IsSubtle  bool          `json:"isSubtle,omitempty"`
+	Wrap      bool          `json:"wrap,omitempty"`
+	Separator bool          `json:"separator,omitempty"`
+	Style     string        `json:"style,omitempty"`
+	Items     []CardElement `json:"items,omitempty"`
+}
+
+func TextBlock(text string) CardElement {
+	return CardElement{Type: "TextBlock", Text: text, Wrap: true}
+}
+
+func StrongTextBlock(text string) CardElement {
+	return CardElement{Type: "TextBlock", Text: text, Weight: "Bolder", Wrap: true}
+}
+
+func HeadingBlock(text string) CardElement {
+	return CardElement{Type: "TextBlock", Text: text, Size: "Medium", Weight: "Bolder", Wrap: true}
+}
+
+// Container groups items, style is good, warning or attention to colour it by the severity of a section.
+func Container(style string, items ...CardElement) CardElement {
+	return CardElement{Type: "Container", Style: style, Items: items}
+}
+
+// NewTeamsMessage returns a message with an Adaptive Card showing body over the full width of the chat.
+func NewTeamsMessage(body []CardElement) *TeamsMessage {
+	return &TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: &AdaptiveCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.4",
+					Body:    body,
+					MsTeams: map[string]string{"width": "Full"},
+				},
+			},
+		},
+	}
+}
+
+// CardElements renders the overview as a container for today and the next wachtdienst followed by the end of the
+// roster in small print. The header is left out when it is empty. Members are shown by name, as Slack mentions have
+// no meaning in Teams.
+func (overview *Overview) CardElements(header string) []CardElement {
+	elements := make([]CardElement, 0, 4)
+
+	if header != "" {
+		elements = append(elements, HeadingBlock(header))
+	}
+
+	today, todaySeverity := overview.today()
+	elements = append(elements, Container(containerStyle(todaySeverity), StrongTextBlock("Vandaag"), TextBlock(today.String())))
+
+	if overview.Next != nil {
+		next, nextSeverity := overview.next()
+		elements = append(elements, Container(containerStyle(nextSeverity), StrongTextBlock("Volgende"), TextBlock(next.String())))
+	}
+
+	if overview.HasRoster {
+		rosterEnd := TextBlock(overview.rosterEnd())
+		rosterEnd.Size = "Small"
+		rosterEnd.IsSubtle = true
+		elements = append(elements, rosterEnd)
+	}
+
+	return elements
+}
+
+// TeamsNotifier posts Adaptive Cards to a Microsoft Teams incoming webhook.
+type TeamsNotifier struct {
+	Webhook string
+}
+
+func (notifier *TeamsNotifier) Notify(ctx context.Context, overviews []*Overview) error {
+	body := make([]CardElement, 0)
+
+	if len(overviews) == 1 {
+		body = append(body, overviews[0].CardElements("📞 Wachtdienst "+overviews[0].Schedule.GroupName)...)
+	} else {
+		body = append(body, HeadingBlock("📞 Wachtdienst"))
+
+		for _, overview := range overviews {
+			elements := overview.CardElements(overview.Schedule.GroupName)
+			elements[0].Separator = true
+			body = append(body, elements...)
+		}
+	}
+
+	return notifier.post(ctx, NewTeamsMessage(body))
+}
+
+func (notifier *TeamsNotifier) NotifyFailure(ctx context.Context, schedule nervecentre.Schedule, message string) error {
+	text := TextBlock("Kon wachtdiensten niet ophalen uit Nerve Centre: " + message)
+	text.Color = "Attention"
+
+	return notifier.post(ctx, NewTeamsMessage([]CardElement{HeadingBlock("⚠️ Wachtdienst " + schedule.GroupName), text}))
+}
+
+// Send renders the sender of message as the heading, followed by its text and a container for every section.
+func (notifier *TeamsNotifier) Send(ctx context.Context, message *Message) error {
+	body := []CardElement{HeadingBlock(message.Username())}
+
+	if len(message.Text) > 0 {
+		body = append(body, TextBlock(message.Text.String()))
+	}
+
+	for _, section := range message.Sections {
+		items := []CardElement{StrongTextBlock(section.Title)}
+
+		if len(section.Text) > 0 {
+			items = append(items, TextBlock(section.Text.String()))
+		}
+
+		body = append(body, Container(containerStyle(section.Severity), items...))
+	}
+
+	return notifier.post(ctx, NewTeamsMessage(body))
+}
+
+func (notifier *TeamsNotifier) post(ctx context.Context, message *TeamsMessage) error {
+	return postJson(ctx, "teams", notifier.Webhook, message)
+}
+
+// containerStyle returns the style of a container of severity.
+func containerStyle(severity Severity) string {
+	switch severity {
+	case SeverityGood:
+		return "good"
+	case SeverityWarning:
+		return "warning"
+	case SeverityAttention:
+		return "attention"
+	default:
+		return "default"
+	}
+}
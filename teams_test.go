@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/robbertnoordzij/nerve-centre-webhook/nervecentre"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTeamsNotifier(t *testing.T) {
+	core, platform := newTestOverviews()
+
+	tests := []struct {
+		name   string
+		notify func(notifier Notifier) error
+	}{
+		{
+			name: "teams-overview.json",
+			notify: func(notifier Notifier) error {
+				return notifier.Notify(context.Background(), []*Overview{core})
+			},
+		},
+		{
+			name: "teams-combined.json",
+			notify: func(notifier Notifier) error {
+				return notifier.Notify(context.Background(), []*Overview{core, platform})
+			},
+		},
+		{
+			name: "teams-failure.json",
+			notify: func(notifier Notifier) error {
+				return notifier.NotifyFailure(context.Background(), nervecentre.Schedule{GroupName: "Core"}, "could not login")
+			},
+		},
+		{
+			name: "teams-message.json",
+			notify: func(notifier Notifier) error {
+				return notifier.Send(context.Background(), &Message{
+					Icon:     "📞",
+					Schedule: nervecentre.Schedule{GroupName: "Core"},
+					Text:     Text{{Text: "Overdracht van de wachtdienst Core: Alice → "}, {Members: []string{"Bob"}}},
+					Sections: []Section{
+						{Title: "Uit dienst", Text: NewText("Alice"), Severity: SeverityWarning},
+						{Title: "In dienst", Text: Text{{Members: []string{"Bob"}}}, Severity: SeverityGood},
+					},
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+
+				var message struct {
+					Type        string
+					Attachments []struct {
+						ContentType string
+						Content     struct {
+							Type string
+							Body []json.RawMessage
+						}
+					}
+				}
+
+				if err := json.Unmarshal(body, &message); err != nil || r.Header.Get("Content-Type") != "application/json" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if message.Type != "message" || len(message.Attachments) != 1 ||
+					message.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" ||
+					message.Attachments[0].Content.Type != "AdaptiveCard" || len(message.Attachments[0].Content.Body) == 0 {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				// Workflows webhooks answer 202 instead of 200
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer ts.Close()
+
+			if err := tt.notify(&TeamsNotifier{Webhook: ts.URL}); err != nil {
+				t.Fatalf("TeamsNotifier error = %v", err)
+			}
+
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, body, "", "  "); err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, tt.name, append(indented.Bytes(), '\n'))
+		})
+	}
+}
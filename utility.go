@@ -1,5 +1,13 @@
 package main
 
+import (
+	"4d63.com/tz"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 func Equal(a, b []string) bool {
 	// If one is nil, the other must also be nil.
 	if (a == nil) != (b == nil) {
@@ -18,3 +26,115 @@ func Equal(a, b []string) bool {
 
 	return true
 }
+
+// Days is a number of days that can be set as 90d, 12w or as a duration like 36h, which is rounded up to whole days.
+type Days int
+
+func (days *Days) String() string {
+	return strconv.Itoa(int(*days)) + "d"
+}
+
+func (days *Days) Set(value string) error {
+	parsed, err := ParseDays(value)
+
+	if err != nil {
+		return err
+	}
+
+	*days = parsed
+
+	return nil
+}
+
+func (days *Days) UnmarshalText(text []byte) error {
+	return days.Set(string(text))
+}
+
+func ParseDays(value string) (Days, error) {
+	value = strings.TrimSpace(value)
+
+	for suffix, multiplier := range map[string]int{"d": 1, "w": 7} {
+		if strings.HasSuffix(value, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+
+			if err != nil || count < 1 {
+				return 0, fmt.Errorf("invalid number of days %q", value)
+			}
+
+			return Days(count * multiplier), nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid number of days %q, use for example 90d, 12w or 36h", value)
+	}
+
+	return Days((duration + 24*time.Hour - 1) / (24 * time.Hour)), nil
+}
+
+// Duration is a time.Duration that can be read from configuration files as 2h or 30m.
+type Duration time.Duration
+
+func (duration *Duration) String() string {
+	return time.Duration(*duration).String()
+}
+
+func (duration *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use for example 2h or 30m", value)
+	}
+
+	*duration = Duration(parsed)
+
+	return nil
+}
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	return duration.Set(string(text))
+}
+
+// ScheduleTimezones maps a group id or group name to a timezone, set as group=timezone.
+type ScheduleTimezones map[string]*time.Location
+
+func (timezones ScheduleTimezones) String() string {
+	values := make([]string, 0, len(timezones))
+
+	for group, location := range timezones {
+		values = append(values, group+"="+location.String())
+	}
+
+	return strings.Join(values, ",")
+}
+
+// Set adds one group=timezone pair, or several separated by commas as in the environment variable.
+func (timezones ScheduleTimezones) Set(value string) error {
+	if strings.Contains(value, ",") {
+		for _, pair := range strings.Split(value, ",") {
+			if err := timezones.Set(pair); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(value), "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid schedule timezone %q, use group=timezone", value)
+	}
+
+	location, err := tz.LoadLocation(parts[1])
+
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q: %w", parts[1], err)
+	}
+
+	timezones[parts[0]] = location
+
+	return nil
+}
@@ -61,3 +61,49 @@ func TestEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Days
+		wantErr bool
+	}{
+		{
+			name:  "days",
+			value: "90d",
+			want:  90,
+		},
+		{
+			name:  "weeks",
+			value: "2w",
+			want:  14,
+		},
+		{
+			name:  "duration rounded up",
+			value: "36h",
+			want:  2,
+		},
+		{
+			name:    "zero",
+			value:   "0d",
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			value:   "soon",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDays(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDays() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}